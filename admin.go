@@ -0,0 +1,196 @@
+package emulatorauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ModeChangeFunc is called after SetMode changes the client mode. Calls come
+// one at a time, in the order the changes took effect; fn may read the mode
+// but must not call SetMode.
+type ModeChangeFunc func(from, to AuthMode)
+
+// WithModeChangeFunc reports runtime mode changes to fn
+func WithModeChangeFunc(fn ModeChangeFunc) Option {
+	return func(o *clientOptions) {
+		o.modeChange = fn
+	}
+}
+
+// Mode returns the current client mode
+func (c *Client) Mode() AuthMode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mode
+}
+
+// SetMode switches the client mode without restarting, e.g. between test
+// runs sharing an emulator container. Checks already in flight finish in the
+// old mode. Switching to AuthModeOff allows every later check without asking
+// IAM. Changes are reported through WithModeChangeFunc and, as mode_change
+// events, WithAuditTrace, in the order they took effect, even when SetMode
+// runs concurrently.
+func (c *Client) SetMode(mode AuthMode) error {
+	if !mode.isValid() {
+		return fmt.Errorf("unknown auth mode %q", mode)
+	}
+
+	// Held through the notification, so the last change reported is the
+	// mode in effect; mu is released first so callbacks can call Mode
+	c.setModeMu.Lock()
+	defer c.setModeMu.Unlock()
+
+	c.mu.Lock()
+	from := c.mode
+	c.mode = mode
+	c.mu.Unlock()
+
+	if from != mode {
+		c.notifyModeChange(from, mode)
+	}
+	return nil
+}
+
+// Timeout returns the current per-check timeout
+func (c *Client) Timeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.timeout
+}
+
+// SetTimeout changes the per-check timeout without restarting. Checks
+// already in flight keep their old timeout.
+func (c *Client) SetTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", timeout)
+	}
+
+	c.mu.Lock()
+	c.timeout = timeout
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) notifyModeChange(from, to AuthMode) {
+	if c.modeChange != nil {
+		c.modeChange(from, to)
+	}
+	if c.auditTrace != nil {
+		_ = c.auditTrace.Emit(trace.AuthzEvent{
+			SchemaVersion: trace.SchemaV1_0,
+			EventType:     trace.EventTypeModeChange,
+			Timestamp:     trace.NowRFC3339Nano(),
+			Environment:   &trace.Environment{Mode: to.String()},
+			ModeChange:    &trace.ModeChange{From: from.String(), To: to.String()},
+		})
+	}
+}
+
+// modeRequest is the JSON body read and written by ModeHandler
+type modeRequest struct {
+	Mode string `json:"mode"`
+}
+
+// ModeHandler returns an http.Handler for reading and switching the client
+// mode at runtime: GET reports {"mode":"strict"}, PUT or POST with the same
+// body switches it. It performs no authentication of its own, so only expose
+// it on an admin port.
+func (c *Client) ModeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPost:
+			var req modeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				WriteHTTPError(w, status.Newf(codes.InvalidArgument, "invalid mode request: %v", err))
+				return
+			}
+			mode, err := ParseAuthModeStrict(req.Mode)
+			if err == nil {
+				err = c.SetMode(mode)
+			}
+			if err != nil {
+				WriteHTTPError(w, status.New(codes.InvalidArgument, err.Error()))
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(modeRequest{Mode: c.Mode().String()})
+	})
+}
+
+// ModeServiceName is the gRPC service registered by RegisterModeService
+const ModeServiceName = "emulatorauth.v1.ModeService"
+
+// RegisterModeService registers a gRPC admin service for the client mode on
+// s, the gRPC counterpart of ModeHandler:
+//
+//	rpc GetMode(google.protobuf.Empty) returns (google.protobuf.StringValue)
+//	rpc SetMode(google.protobuf.StringValue) returns (google.protobuf.StringValue)
+//
+// Like ModeHandler it performs no authentication of its own.
+func RegisterModeService(s grpc.ServiceRegistrar, c *Client) {
+	s.RegisterService(&modeServiceDesc, c)
+}
+
+var modeServiceDesc = grpc.ServiceDesc{
+	ServiceName: ModeServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetMode", Handler: getModeHandler},
+		{MethodName: "SetMode", Handler: setModeHandler},
+	},
+}
+
+func getModeHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return wrapperspb.String(srv.(*Client).Mode().String()), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ModeServiceName + "/GetMode"}, handler)
+}
+
+func setModeHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		c := srv.(*Client)
+		mode, err := ParseAuthModeStrict(req.(*wrapperspb.StringValue).GetValue())
+		if err == nil {
+			err = c.SetMode(mode)
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return wrapperspb.String(c.Mode().String()), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ModeServiceName + "/SetMode"}, handler)
+}
@@ -0,0 +1,230 @@
+package emulatorauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestClient_SetMode(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+
+	var changes [][2]AuthMode
+	client, err := NewClient(addr, AuthModeStrict, WithModeChangeFunc(func(from, to AuthMode) {
+		changes = append(changes, [2]AuthMode{from, to})
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetMode("lenient"); err == nil {
+		t.Error("SetMode() should reject an unknown mode")
+	}
+	if client.Mode() != AuthModeStrict {
+		t.Errorf("Mode() = %v after rejected SetMode, want strict", client.Mode())
+	}
+
+	for _, mode := range []AuthMode{AuthModePermissive, AuthModePermissive, AuthModeOff} {
+		if err := client.SetMode(mode); err != nil {
+			t.Fatalf("SetMode(%v) error = %v", mode, err)
+		}
+	}
+	if client.Mode() != AuthModeOff {
+		t.Errorf("Mode() = %v, want off", client.Mode())
+	}
+
+	// Unchanged modes are not reported
+	want := [][2]AuthMode{{AuthModeStrict, AuthModePermissive}, {AuthModePermissive, AuthModeOff}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	// Off allows without asking IAM
+	d, err := client.Decide(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+	if err != nil || !d.Allowed || d.Reason != ReasonDisabled || d.Mode != AuthModeOff {
+		t.Errorf("Decide() = %+v, %v, want disabled", d, err)
+	}
+	if fake.Calls() != 0 {
+		t.Errorf("IAM calls = %d, want 0 while off", fake.Calls())
+	}
+}
+
+func TestClient_SetModeConcurrent(t *testing.T) {
+	_, addr := startFakeIAMServer(t)
+
+	// Serialized by SetMode, so no locking needed
+	var changes [][2]AuthMode
+	var client *Client
+	client, err := NewClient(addr, AuthModeStrict, WithModeChangeFunc(func(from, to AuthMode) {
+		changes = append(changes, [2]AuthMode{from, to})
+		if mode := client.Mode(); mode != to {
+			t.Errorf("Mode() = %v while reporting change to %v", mode, to)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = client.SetMode([]AuthMode{AuthModeStrict, AuthModePermissive, AuthModeAudit}[i%3])
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = client.CheckPermission(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+		}()
+	}
+	wg.Wait()
+
+	// Changes are reported in the order they took effect: each starts where
+	// the last one ended, and the last one ends at the current mode
+	last := AuthModeStrict
+	for _, change := range changes {
+		if change[0] != last {
+			t.Errorf("change %v does not follow %v (changes %v)", change, last, changes)
+		}
+		last = change[1]
+	}
+	if mode := client.Mode(); last != mode {
+		t.Errorf("last reported mode = %v, Mode() = %v", last, mode)
+	}
+}
+
+func TestClient_SetModeTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	w, err := trace.NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	client, err := NewClient("localhost:9999", AuthModePermissive, WithAuditTrace(w))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetMode(AuthModeStrict); err != nil {
+		t.Fatalf("SetMode() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	var ev trace.AuthzEvent
+	if err := json.Unmarshal(bytes.TrimSpace(data), &ev); err != nil {
+		t.Fatalf("invalid trace %q: %v", data, err)
+	}
+	if ev.EventType != trace.EventTypeModeChange || ev.ModeChange == nil ||
+		ev.ModeChange.From != "permissive" || ev.ModeChange.To != "strict" {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestModeHandler(t *testing.T) {
+	client, err := NewClient("localhost:9999", AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		wantCode int
+		wantMode AuthMode
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, AuthModeStrict},
+		{"put", http.MethodPut, `{"mode":"Permissive"}`, http.StatusOK, AuthModePermissive},
+		{"post dryrun", http.MethodPost, `{"mode":"dryrun"}`, http.StatusOK, AuthModeAudit},
+		{"unknown mode", http.MethodPut, `{"mode":"strcit"}`, http.StatusBadRequest, AuthModeAudit},
+		{"invalid body", http.MethodPut, `mode=strict`, http.StatusBadRequest, AuthModeAudit},
+		{"wrong method", http.MethodDelete, "", http.StatusMethodNotAllowed, AuthModeAudit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			client.ModeHandler().ServeHTTP(rec, httptest.NewRequest(tt.method, "/admin/mode", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if client.Mode() != tt.wantMode {
+				t.Errorf("Mode() = %v, want %v", client.Mode(), tt.wantMode)
+			}
+			if rec.Code == http.StatusOK {
+				var resp modeRequest
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Mode != tt.wantMode.String() {
+					t.Errorf("body mode = %q (%v), want %q", resp.Mode, err, tt.wantMode)
+				}
+			}
+		})
+	}
+}
+
+func TestModeService(t *testing.T) {
+	client, err := NewClient("localhost:9999", AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	RegisterModeService(server, client)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	out := new(wrapperspb.StringValue)
+	if err := conn.Invoke(ctx, "/"+ModeServiceName+"/GetMode", &emptypb.Empty{}, out); err != nil || out.GetValue() != "strict" {
+		t.Errorf("GetMode() = %q, %v, want strict", out.GetValue(), err)
+	}
+
+	if err := conn.Invoke(ctx, "/"+ModeServiceName+"/SetMode", wrapperspb.String("permissive"), out); err != nil || out.GetValue() != "permissive" {
+		t.Errorf("SetMode() = %q, %v, want permissive", out.GetValue(), err)
+	}
+	if client.Mode() != AuthModePermissive {
+		t.Errorf("Mode() = %v, want permissive", client.Mode())
+	}
+
+	err = conn.Invoke(ctx, "/"+ModeServiceName+"/SetMode", wrapperspb.String("bogus"), out)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetMode(bogus) error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,90 @@
+package emulatorauth
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AnonymousPolicy defines how checks without a principal are handled
+type AnonymousPolicy string
+
+const (
+	// AnonymousPassthrough sends checks without a principal to IAM as they
+	// are, leaving the outcome to the IAM emulator (default)
+	AnonymousPassthrough AnonymousPolicy = "passthrough"
+
+	// AnonymousAllUsers checks them as allUsers, so only public bindings
+	// grant access
+	AnonymousAllUsers AnonymousPolicy = "all_users"
+
+	// AnonymousReject rejects them as Unauthenticated (HTTP 401) without
+	// asking IAM, as real GCP does for requests without credentials
+	AnonymousReject AnonymousPolicy = "reject"
+)
+
+// WithAnonymousPolicy sets how checks without a principal are handled
+// (AnonymousPassthrough by default). It applies to every Client check, so
+// the interceptors and middleware follow it too.
+func WithAnonymousPolicy(policy AnonymousPolicy) Option {
+	return func(o *clientOptions) {
+		o.anonymousPolicy = policy
+	}
+}
+
+// WithDefaultPrincipal checks requests without a principal as principal,
+// e.g. "user:dev@example.com" for tests that never set one. The anonymous
+// policy then never applies.
+func WithDefaultPrincipal(principal string) Option {
+	return func(o *clientOptions) {
+		o.defaultPrincipal = principal
+	}
+}
+
+func parseAnonymousPolicy(s string) AnonymousPolicy {
+	return AnonymousPolicy(strings.ToLower(strings.TrimSpace(s)))
+}
+
+func (p AnonymousPolicy) validate() error {
+	switch p {
+	case "", AnonymousPassthrough, AnonymousAllUsers, AnonymousReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown anonymous policy %q (want passthrough, all_users or reject)", p)
+	}
+}
+
+// anonymousPrincipal returns the principal to check a request as, applying
+// the default principal and AnonymousAllUsers to a missing one
+func (c *Client) anonymousPrincipal(principal string) string {
+	switch {
+	case principal != "":
+		return principal
+	case c.defaultPrincipal != "":
+		return c.defaultPrincipal
+	case c.anonymousPolicy == AnonymousAllUsers:
+		return string(PrincipalTypeAllUsers)
+	default:
+		return ""
+	}
+}
+
+// rejectAnonymous denies every permission as unauthenticated without asking
+// IAM
+func (c *Client) rejectAnonymous(mode AuthMode, resource string, permissions []string) (map[string]Decision, error) {
+	st := status.New(codes.Unauthenticated, "request has no principal")
+
+	decisions := make(map[string]Decision, len(permissions))
+	for _, permission := range permissions {
+		decisions[permission] = Decision{
+			Reason:     ReasonUnauthenticated,
+			Mode:       c.modeOverrides.Mode(resource, permission, mode),
+			Resource:   resource,
+			Permission: permission,
+			Status:     st,
+		}
+	}
+	return decisions, wrapError(st.Err())
+}
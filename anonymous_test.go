@@ -0,0 +1,130 @@
+package emulatorauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAnonymousPolicy(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+
+	var got string
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		got = ExtractPrincipalFromContext(ctx)
+		return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "passthrough by default", want: ""},
+		{name: "explicit passthrough", opts: []Option{WithAnonymousPolicy(AnonymousPassthrough)}, want: ""},
+		{name: "all users", opts: []Option{WithAnonymousPolicy(AnonymousAllUsers)}, want: "allUsers"},
+		{name: "default principal", opts: []Option{WithDefaultPrincipal("user:dev@example.com")}, want: "user:dev@example.com"},
+		{name: "default principal wins over reject", opts: []Option{WithAnonymousPolicy(AnonymousReject), WithDefaultPrincipal("user:dev@example.com")}, want: "user:dev@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, addr, AuthModeStrict, tt.opts...)
+
+			got = "unset"
+			d, err := client.Decide(context.Background(), "", "projects/test-project", "secretmanager.secrets.get")
+			if err != nil {
+				t.Fatalf("Decide() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IAM saw principal %q, want %q", got, tt.want)
+			}
+			if d.Principal != tt.want {
+				t.Errorf("Decision.Principal = %q, want %q", d.Principal, tt.want)
+			}
+
+			// Requests with a principal are unaffected
+			if _, err := client.Decide(context.Background(), "user:alice@example.com", "projects/test-project", "secretmanager.secrets.get"); err != nil {
+				t.Fatalf("Decide() error = %v", err)
+			}
+			if got != "user:alice@example.com" {
+				t.Errorf("IAM saw principal %q, want user:alice@example.com", got)
+			}
+		})
+	}
+}
+
+func TestAnonymousReject(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict, WithAnonymousPolicy(AnonymousReject))
+
+	before := fake.Calls()
+	d, err := client.Decide(context.Background(), "", "projects/test-project", "secretmanager.secrets.get")
+	if !errors.Is(err, ErrUnauthenticated) || status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Decide() error = %v, want ErrUnauthenticated", err)
+	}
+	if d.Allowed || d.Reason != ReasonUnauthenticated {
+		t.Errorf("Decision = %+v, want unauthenticated denial", d)
+	}
+	if status.Code(d.Err()) != codes.Unauthenticated {
+		t.Errorf("Decision.Err() = %v, want Unauthenticated", d.Err())
+	}
+	if calls := fake.Calls() - before; calls != 0 {
+		t.Errorf("IAM calls = %d, want 0", calls)
+	}
+
+	// Audit mode reports the rejection instead of enforcing it
+	var audited []Decision
+	auditClient := newTestClient(t, addr, AuthModeAudit, WithAnonymousPolicy(AnonymousReject),
+		WithAuditFunc(func(ctx context.Context, d Decision) { audited = append(audited, d) }))
+	d, err = auditClient.Decide(context.Background(), "", "projects/test-project", "secretmanager.secrets.get")
+	if err != nil || !d.Allowed || !d.WouldDeny || d.Reason != ReasonUnauthenticated {
+		t.Errorf("audit Decide() = %+v, %v; want allowed would-be unauthenticated", d, err)
+	}
+	if len(audited) != 1 {
+		t.Errorf("audited %d decisions, want 1", len(audited))
+	}
+
+	// Off mode never checks
+	offClient := newTestClient(t, addr, AuthModeOff, WithAnonymousPolicy(AnonymousReject))
+	if allowed, err := offClient.CheckPermission(context.Background(), "", "projects/test-project", "secretmanager.secrets.get"); !allowed || err != nil {
+		t.Errorf("off CheckPermission() = %v, %v; want allowed", allowed, err)
+	}
+}
+
+func TestAnonymousReject_Enforcement(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict, WithAnonymousPolicy(AnonymousReject))
+
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	_, err := UnaryServerInterceptor(client, testRules)(context.Background(),
+		&iampb.GetIamPolicyRequest{Resource: "projects/test-project"}, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("interceptor error = %v, want Unauthenticated", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+	Middleware(client, testRoutes)(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status code = %d, want 401 (body %s)", rec.Code, rec.Body)
+	}
+}
+
+func TestAnonymousOptions_Invalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"unknown policy":    WithAnonymousPolicy("ignore"),
+		"invalid principal": WithDefaultPrincipal("dev@example.com"),
+	} {
+		if _, err := NewClient("localhost:1", AuthModeStrict, opt); err == nil {
+			t.Errorf("%s: NewClient() should fail", name)
+		}
+	}
+}
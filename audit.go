@@ -0,0 +1,67 @@
+package emulatorauth
+
+import (
+	"context"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+// AuditFunc receives every check audit mode allowed that enforcement would
+// have denied. It runs synchronously on the checking goroutine.
+type AuditFunc func(ctx context.Context, d Decision)
+
+// WithAuditFunc reports would-be denials in AuthModeAudit to fn
+func WithAuditFunc(fn AuditFunc) Option {
+	return func(o *clientOptions) {
+		o.auditFunc = fn
+	}
+}
+
+// WithAuditTrace writes would-be denials in AuthModeAudit to w as
+// authz_audit events, and SetMode changes as mode_change events. The client
+// does not flush or close w.
+func WithAuditTrace(w *trace.Writer) Option {
+	return func(o *clientOptions) {
+		o.auditTrace = w
+	}
+}
+
+// audit allows every denied decision in audit mode, reporting each one in
+// request order
+func (c *Client) audit(ctx context.Context, permissions []string, decisions map[string]Decision) {
+	for _, permission := range permissions {
+		d, ok := decisions[permission]
+		if !ok || d.Allowed || d.Mode != AuthModeAudit {
+			continue
+		}
+
+		d.Allowed = true
+		d.WouldDeny = true
+		decisions[permission] = d
+
+		if c.auditFunc != nil {
+			c.auditFunc(ctx, d)
+		}
+		if c.auditTrace != nil {
+			_ = c.auditTrace.Emit(d.auditEvent())
+		}
+	}
+}
+
+// auditEvent returns a would-be denial as an authz_audit event
+func (d Decision) auditEvent() trace.AuthzEvent {
+	decision := d.Trace()
+	decision.Outcome = trace.OutcomeDeny
+
+	return trace.AuthzEvent{
+		SchemaVersion: trace.SchemaV1_0,
+		EventType:     trace.EventTypeAuthzAudit,
+		Timestamp:     trace.NowRFC3339Nano(),
+		Actor:         d.TraceActor(),
+		Target:        &trace.Target{Resource: d.Resource},
+		Action:        &trace.Action{Permission: d.Permission},
+		Decision:      decision,
+		Environment:   &trace.Environment{Mode: d.Mode.String()},
+		Error:         d.TraceError(),
+	}
+}
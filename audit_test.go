@@ -0,0 +1,237 @@
+package emulatorauth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditRecorder collects decisions passed to an AuditFunc
+type auditRecorder struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+func (r *auditRecorder) record(_ context.Context, d Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions = append(r.decisions, d)
+}
+
+func (r *auditRecorder) get() []Decision {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Decision(nil), r.decisions...)
+}
+
+func TestClient_AuditMode(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return &iampb.TestIamPermissionsResponse{Permissions: []string{"secretmanager.secrets.get"}}, nil
+	})
+
+	recorder := &auditRecorder{}
+	client, err := NewClient(addr, AuthModeAudit, WithAuditFunc(recorder.record))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	granted, err := client.CheckPermissions(ctx, "user:test@example.com", "projects/test-project",
+		[]string{"secretmanager.secrets.get", "secretmanager.versions.access"})
+	if err != nil {
+		t.Fatalf("CheckPermissions() error = %v", err)
+	}
+	for permission, allowed := range granted {
+		if !allowed {
+			t.Errorf("audit mode denied %s", permission)
+		}
+	}
+
+	got := recorder.get()
+	if len(got) != 1 {
+		t.Fatalf("audit func called %d times, want 1", len(got))
+	}
+	d := got[0]
+	if d.Permission != "secretmanager.versions.access" || !d.Allowed || !d.WouldDeny || d.Reason != ReasonDenied || d.Mode != AuthModeAudit {
+		t.Errorf("audited decision = %+v", d)
+	}
+
+	// Granted checks are not reported
+	d, err = client.Decide(ctx, "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+	if err != nil || !d.Allowed || d.WouldDeny {
+		t.Errorf("Decide() = %+v, %v, want plain grant", d, err)
+	}
+	if len(recorder.get()) != 1 {
+		t.Errorf("audit func called for a granted check")
+	}
+}
+
+func TestClient_InvalidPrincipal(t *testing.T) {
+	fake, addr := startAliceOnlyIAMServer(t)
+	ctx := context.Background()
+
+	// Denied without asking IAM, with an error saying why
+	client := newTestClient(t, addr, AuthModeStrict)
+	for _, principal := range []string{"serviceaccount:app@test-project.iam.gserviceaccount.com", "alice@example.com"} {
+		d, err := client.Decide(ctx, principal, "projects/test-project", "secretmanager.secrets.get")
+		if !errors.Is(err, ErrInvalidRequest) || status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Decide(%q) error = %v, want ErrInvalidRequest with InvalidArgument", principal, err)
+		}
+		if d.Allowed || d.Reason != ReasonInvalidPrincipal || status.Code(d.Err()) != codes.InvalidArgument {
+			t.Errorf("Decide(%q) = %+v, want invalid principal denial", principal, d)
+		}
+
+		allowed, err := client.CheckPermission(ctx, principal, "projects/test-project", "secretmanager.secrets.get")
+		if allowed || !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("CheckPermission(%q) = %v, %v, want denial with ErrInvalidRequest", principal, allowed, err)
+		}
+	}
+
+	// Audit mode reports it as a would-be denial
+	recorder := &auditRecorder{}
+	client = newTestClient(t, addr, AuthModeAudit, WithAuditFunc(recorder.record))
+	d, err := client.Decide(ctx, "alice@example.com", "projects/test-project", "secretmanager.secrets.get")
+	if err != nil || !d.Allowed || !d.WouldDeny || d.Reason != ReasonInvalidPrincipal {
+		t.Errorf("Decide() = %+v, %v, want audited invalid principal", d, err)
+	}
+	if len(recorder.get()) != 1 {
+		t.Errorf("audit func called %d times, want 1", len(recorder.get()))
+	}
+
+	if calls := fake.Calls(); calls != 0 {
+		t.Errorf("IAM calls = %d, want 0", calls)
+	}
+}
+
+func TestClient_AuditModeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       codes.Code
+		wantReason DecisionReason
+	}{
+		{"unreachable would fail closed", codes.Unavailable, ReasonFailClosed},
+		{"config error", codes.InvalidArgument, ReasonConfigError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, addr := startFakeIAMServer(t)
+			fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+				return nil, status.Error(tt.code, "rejected")
+			})
+
+			recorder := &auditRecorder{}
+			client, err := NewClient(addr, AuthModeAudit, WithAuditFunc(recorder.record))
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			allowed, err := client.CheckPermission(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+			if !allowed || err != nil {
+				t.Errorf("CheckPermission() = %v, %v, want allowed without error", allowed, err)
+			}
+			if got := recorder.get(); len(got) != 1 || got[0].Reason != tt.wantReason {
+				t.Errorf("audited decisions = %+v, want one with reason %v", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestClient_AuditModeCachedDenial(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return &iampb.TestIamPermissionsResponse{}, nil
+	})
+
+	recorder := &auditRecorder{}
+	client, err := NewClient(addr, AuthModeAudit,
+		WithCache(CacheConfig{Size: 10, TTL: time.Minute}),
+		WithAuditFunc(recorder.record),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		d, _ := client.Decide(ctx, "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+		if !d.Allowed || !d.WouldDeny {
+			t.Errorf("Decide() #%d = %+v, want audited denial", i, d)
+		}
+	}
+
+	got := recorder.get()
+	if len(got) != 2 || got[0].Cached || !got[1].Cached {
+		t.Errorf("audited decisions = %+v, want one fresh and one cached", got)
+	}
+}
+
+func TestClient_AuditTrace(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return &iampb.TestIamPermissionsResponse{}, nil
+	})
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w, err := trace.NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	client, err := NewClient(addr, AuthModeAudit, WithAuditTrace(w))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	_, _ = client.CheckPermission(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.versions.access")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open trace: %v", err)
+	}
+	defer f.Close()
+
+	var events []trace.AuthzEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev trace.AuthzEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid trace line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("trace has %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.EventType != trace.EventTypeAuthzAudit || ev.SchemaVersion != trace.SchemaV1_0 {
+		t.Errorf("event type/schema = %s/%s", ev.EventType, ev.SchemaVersion)
+	}
+	if ev.Decision == nil || ev.Decision.Outcome != trace.OutcomeDeny || ev.Decision.Reason != "denied" {
+		t.Errorf("event decision = %+v, want would-be DENY", ev.Decision)
+	}
+	if ev.Actor.Principal != "user:test@example.com" || ev.Actor.PrincipalType != "user" || ev.Target.Resource != "projects/test-project" ||
+		ev.Action.Permission != "secretmanager.versions.access" || ev.Environment.Mode != "audit" {
+		t.Errorf("event = %+v", ev)
+	}
+}
@@ -0,0 +1,181 @@
+package emulatorauth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of the client circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed sends every check to IAM
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen short-circuits every check to the mode's fail-open or
+	// fail-closed decision without calling IAM
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen lets a single probe through to see if IAM is back
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig configures the circuit breaker around the IAM emulator
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive connectivity errors that
+	// opens the breaker
+	FailureThreshold int
+
+	// ProbeInterval is how long the breaker stays open before a probe check
+	// is let through
+	ProbeInterval time.Duration
+
+	// OnStateChange, if set, is called after every state transition
+	OnStateChange func(from, to BreakerState)
+}
+
+// WithCircuitBreaker stops calling an unreachable IAM emulator after
+// FailureThreshold consecutive connectivity errors. While open, checks resolve
+// immediately as if IAM were unreachable (fail-open in permissive mode,
+// fail-closed in strict mode), so callers don't each wait out the timeout.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(o *clientOptions) {
+		o.breaker = &cfg
+	}
+}
+
+func (cfg BreakerConfig) validate() error {
+	if cfg.FailureThreshold <= 0 {
+		return errors.New("circuit breaker failure threshold must be positive")
+	}
+	if cfg.ProbeInterval <= 0 {
+		return errors.New("circuit breaker probe interval must be positive")
+	}
+	return nil
+}
+
+// errBreakerOpen is the status reported for checks short-circuited by an open breaker
+var errBreakerOpen = status.Error(codes.Unavailable, "IAM emulator circuit breaker is open")
+
+type circuitBreaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:   cfg,
+		state: BreakerClosed,
+		now:   time.Now,
+	}
+}
+
+// allow reports whether a check may call IAM
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.ProbeInterval {
+			b.mu.Unlock()
+			return false
+		}
+		from := b.transition(BreakerHalfOpen)
+		b.probing = true
+		b.mu.Unlock()
+		b.notify(from, BreakerHalfOpen)
+		return true
+
+	case BreakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			b.mu.Unlock()
+			return false
+		}
+		b.probing = true
+		b.mu.Unlock()
+		return true
+
+	default:
+		b.mu.Unlock()
+		return true
+	}
+}
+
+// record reports the outcome of an IAM call let through by allow
+func (b *circuitBreaker) record(connectivityFailure bool) {
+	b.mu.Lock()
+
+	b.probing = false
+	from := b.state
+
+	switch {
+	case !connectivityFailure:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+
+	case b.state == BreakerHalfOpen:
+		b.openedAt = b.now()
+		b.transition(BreakerOpen)
+
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.cfg.FailureThreshold {
+			b.openedAt = b.now()
+			b.transition(BreakerOpen)
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// release gives up a call let through by allow without recording an outcome
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// transition sets the state and returns the previous one; caller holds mu
+func (b *circuitBreaker) transition(to BreakerState) BreakerState {
+	from := b.state
+	b.state = to
+	return from
+}
+
+func (b *circuitBreaker) notify(from, to BreakerState) {
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+func (b *circuitBreaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// BreakerState returns the circuit breaker state (always closed without
+// WithCircuitBreaker)
+func (c *Client) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+	return c.breaker.current()
+}
@@ -0,0 +1,249 @@
+package emulatorauth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// transitionRecorder collects breaker state changes
+type transitionRecorder struct {
+	mu          sync.Mutex
+	transitions []BreakerState
+}
+
+func (r *transitionRecorder) record(from, to BreakerState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, to)
+}
+
+func (r *transitionRecorder) get() []BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]BreakerState(nil), r.transitions...)
+}
+
+func TestBreakerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     BreakerConfig
+		wantErr bool
+	}{
+		{"valid", BreakerConfig{FailureThreshold: 3, ProbeInterval: time.Second}, false},
+		{"zero threshold", BreakerConfig{ProbeInterval: time.Second}, true},
+		{"zero probe interval", BreakerConfig{FailureThreshold: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	recorder := &transitionRecorder{}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	b := newCircuitBreaker(BreakerConfig{
+		FailureThreshold: 3,
+		ProbeInterval:    10 * time.Second,
+		OnStateChange:    recorder.record,
+	})
+	b.now = clock.Now
+
+	// Failures below the threshold keep it closed, and a success resets the count
+	b.record(true)
+	b.record(true)
+	b.record(false)
+	b.record(true)
+	b.record(true)
+	if b.current() != BreakerClosed {
+		t.Fatalf("state = %v, want closed", b.current())
+	}
+
+	b.record(true)
+	if b.current() != BreakerOpen {
+		t.Fatalf("state = %v after threshold, want open", b.current())
+	}
+	if b.allow() {
+		t.Error("open breaker should not allow calls before the probe interval")
+	}
+
+	// After the probe interval a single probe goes through
+	clock.Advance(10 * time.Second)
+	if !b.allow() {
+		t.Fatal("breaker should allow a probe after the probe interval")
+	}
+	if b.current() != BreakerHalfOpen {
+		t.Errorf("state = %v, want half-open", b.current())
+	}
+	if b.allow() {
+		t.Error("half-open breaker should allow only one probe at a time")
+	}
+
+	// Failed probe reopens
+	b.record(true)
+	if b.current() != BreakerOpen {
+		t.Fatalf("state = %v after failed probe, want open", b.current())
+	}
+
+	// Successful probe closes
+	clock.Advance(10 * time.Second)
+	b.allow()
+	b.record(false)
+	if b.current() != BreakerClosed {
+		t.Fatalf("state = %v after successful probe, want closed", b.current())
+	}
+
+	expected := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	got := recorder.get()
+	if len(got) != len(expected) {
+		t.Fatalf("transitions = %v, want %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("transition %d = %v, want %v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestCircuitBreaker_ReleaseFreesProbe(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, ProbeInterval: time.Second})
+	b.now = clock.Now
+
+	b.record(true)
+	clock.Advance(time.Second)
+	if !b.allow() {
+		t.Fatal("breaker should allow a probe")
+	}
+
+	// An abandoned probe leaves the breaker half-open for the next caller
+	b.release()
+	if b.current() != BreakerHalfOpen {
+		t.Errorf("state = %v, want half-open", b.current())
+	}
+	if !b.allow() {
+		t.Error("breaker should allow a new probe after release")
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+
+	recorder := &transitionRecorder{}
+	client, err := NewClient(addr, AuthModePermissive, WithCircuitBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		ProbeInterval:    time.Hour,
+		OnStateChange:    recorder.record,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	check := func() Decision {
+		d, err := client.Decide(ctx, "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+		if err != nil {
+			t.Fatalf("Permissive mode should not return error: %v", err)
+		}
+		return d
+	}
+
+	check()
+	check()
+	if client.BreakerState() != BreakerOpen {
+		t.Fatalf("BreakerState() = %v, want open", client.BreakerState())
+	}
+
+	// Open breaker fails open without calling IAM
+	d := check()
+	if !d.Allowed || d.Reason != ReasonFailOpen || d.Attempts != 0 {
+		t.Errorf("short-circuited Decide() = %+v, want fail-open with no attempts", d)
+	}
+	if fake.Calls() != 2 {
+		t.Errorf("IAM calls = %d, want 2", fake.Calls())
+	}
+	if got := recorder.get(); len(got) != 1 || got[0] != BreakerOpen {
+		t.Errorf("transitions = %v, want [open]", got)
+	}
+}
+
+func TestClient_CircuitBreakerStrictMode(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+
+	client, err := NewClient(addr, AuthModeStrict, WithCircuitBreaker(BreakerConfig{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	_, _ = client.CheckPermission(ctx, "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+
+	allowed, err := client.CheckPermission(ctx, "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+	if allowed {
+		t.Error("Strict mode should deny while the breaker is open (fail-closed)")
+	}
+	if !IsConnectivityError(err) {
+		t.Errorf("Expected connectivity error, got: %v", err)
+	}
+	if fake.Calls() != 1 {
+		t.Errorf("IAM calls = %d, want 1", fake.Calls())
+	}
+}
+
+func TestClient_CircuitBreakerIgnoresConfigErrors(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad resource")
+	})
+
+	client, err := NewClient(addr, AuthModeStrict, WithCircuitBreaker(BreakerConfig{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		_, _ = client.CheckPermission(context.Background(), "user:test@example.com", "", "secretmanager.secrets.get")
+	}
+	if client.BreakerState() != BreakerClosed {
+		t.Errorf("BreakerState() = %v, config errors must not open the breaker", client.BreakerState())
+	}
+}
+
+func TestClient_BreakerStateDisabled(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if client.BreakerState() != BreakerClosed {
+		t.Errorf("BreakerState() = %v, want closed", client.BreakerState())
+	}
+}
@@ -0,0 +1,192 @@
+package emulatorauth
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures the opt-in client-side decision cache
+type CacheConfig struct {
+	// Size is the maximum number of cached decisions; the least recently
+	// used entry is evicted when full
+	Size int
+
+	// TTL is how long a granted decision stays cached
+	TTL time.Duration
+
+	// NegativeTTL is how long a denied decision stays cached. Zero uses TTL,
+	// a negative value disables caching of denials.
+	NegativeTTL time.Duration
+}
+
+// CacheStats reports decision cache activity
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// WithCache enables the decision cache. Only decisions IAM actually evaluated
+// (granted or denied) are cached; fail-open, fail-closed and config error
+// outcomes always go back to IAM.
+func WithCache(cfg CacheConfig) Option {
+	return func(o *clientOptions) {
+		o.cache = &cfg
+	}
+}
+
+// IsEnabled returns true if any field is set; the zero value disables the cache
+func (cfg CacheConfig) IsEnabled() bool {
+	return cfg != CacheConfig{}
+}
+
+func (cfg CacheConfig) validate() error {
+	if cfg.Size <= 0 {
+		return errors.New("cache size must be positive")
+	}
+	if cfg.TTL <= 0 {
+		return errors.New("cache TTL must be positive")
+	}
+	return nil
+}
+
+type cacheKey struct {
+	principal  string
+	resource   string
+	permission string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	allowed bool
+	expires time.Time
+}
+
+// decisionCache is a bounded LRU of IAM decisions with per-entry expiry
+type decisionCache struct {
+	mu    sync.Mutex
+	cfg   CacheConfig
+	ll    *list.List
+	items map[cacheKey]*list.Element
+	stats CacheStats
+	now   func() time.Time
+}
+
+func newDecisionCache(cfg CacheConfig) *decisionCache {
+	if cfg.NegativeTTL == 0 {
+		cfg.NegativeTTL = cfg.TTL
+	}
+
+	return &decisionCache{
+		cfg:   cfg,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+		now:   time.Now,
+	}
+}
+
+func (c *decisionCache) get(key cacheKey) (allowed bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		c.stats.Misses++
+		return false, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.removeElement(elem)
+		c.stats.Misses++
+		return false, false
+	}
+
+	c.ll.MoveToFront(elem)
+	c.stats.Hits++
+	return entry.allowed, true
+}
+
+func (c *decisionCache) put(key cacheKey, allowed bool) {
+	ttl := c.cfg.TTL
+	if !allowed {
+		ttl = c.cfg.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(ttl)
+
+	if elem, found := c.items[key]; found {
+		entry := elem.Value.(*cacheEntry)
+		entry.allowed = allowed
+		entry.expires = expires
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, allowed: allowed, expires: expires})
+
+	for c.ll.Len() > c.cfg.Size {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *decisionCache) invalidate(match func(cacheKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.items {
+		if match == nil || match(key) {
+			c.removeElement(elem)
+		}
+	}
+}
+
+func (c *decisionCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	return stats
+}
+
+func (c *decisionCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).key)
+}
+
+// InvalidateCache drops every cached decision. Call it after changing the
+// IAM policy so later checks see the new bindings. No-op without WithCache.
+func (c *Client) InvalidateCache() {
+	if c.cache != nil {
+		c.cache.invalidate(nil)
+	}
+}
+
+// InvalidatePrincipal drops every cached decision for one principal.
+// No-op without WithCache.
+func (c *Client) InvalidatePrincipal(principal string) {
+	if c.cache != nil {
+		c.cache.invalidate(func(key cacheKey) bool {
+			return key.principal == principal
+		})
+	}
+}
+
+// CacheStats returns decision cache counters (zero without WithCache)
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.snapshot()
+}
@@ -0,0 +1,254 @@
+package emulatorauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+)
+
+// fakeClock is a manually advanced time source for cache expiry tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestCache(cfg CacheConfig) (*decisionCache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := newDecisionCache(cfg)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CacheConfig
+		wantErr bool
+	}{
+		{"valid", CacheConfig{Size: 100, TTL: time.Minute}, false},
+		{"negative caching disabled", CacheConfig{Size: 100, TTL: time.Minute, NegativeTTL: -1}, false},
+		{"zero size", CacheConfig{TTL: time.Minute}, true},
+		{"zero TTL", CacheConfig{Size: 100}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecisionCache_TTL(t *testing.T) {
+	cache, clock := newTestCache(CacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: 10 * time.Second})
+
+	grantKey := cacheKey{"user:alice@example.com", "projects/p", "secretmanager.secrets.get"}
+	denyKey := cacheKey{"user:alice@example.com", "projects/p", "secretmanager.secrets.delete"}
+
+	cache.put(grantKey, true)
+	cache.put(denyKey, false)
+
+	if allowed, ok := cache.get(grantKey); !ok || !allowed {
+		t.Errorf("get(grant) = %v, %v; want true, true", allowed, ok)
+	}
+	if allowed, ok := cache.get(denyKey); !ok || allowed {
+		t.Errorf("get(deny) = %v, %v; want false, true", allowed, ok)
+	}
+
+	// Denials expire first
+	clock.Advance(10 * time.Second)
+	if _, ok := cache.get(denyKey); ok {
+		t.Error("denied decision should expire after NegativeTTL")
+	}
+	if _, ok := cache.get(grantKey); !ok {
+		t.Error("granted decision should still be cached")
+	}
+
+	clock.Advance(50 * time.Second)
+	if _, ok := cache.get(grantKey); ok {
+		t.Error("granted decision should expire after TTL")
+	}
+
+	stats := cache.snapshot()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Size != 0 {
+		t.Errorf("stats = %+v, want 3 hits, 2 misses, size 0", stats)
+	}
+}
+
+func TestDecisionCache_NegativeCachingDisabled(t *testing.T) {
+	cache, _ := newTestCache(CacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: -1})
+
+	key := cacheKey{"user:alice@example.com", "projects/p", "secretmanager.secrets.delete"}
+	cache.put(key, false)
+
+	if _, ok := cache.get(key); ok {
+		t.Error("denied decision should not be cached when NegativeTTL is negative")
+	}
+}
+
+func TestDecisionCache_LRUEviction(t *testing.T) {
+	cache, _ := newTestCache(CacheConfig{Size: 2, TTL: time.Minute})
+
+	a := cacheKey{"user:a@example.com", "r", "p"}
+	b := cacheKey{"user:b@example.com", "r", "p"}
+	c := cacheKey{"user:c@example.com", "r", "p"}
+
+	cache.put(a, true)
+	cache.put(b, true)
+	cache.get(a) // a is now most recently used
+	cache.put(c, true)
+
+	if _, ok := cache.get(b); ok {
+		t.Error("least recently used entry should be evicted")
+	}
+	if _, ok := cache.get(a); !ok {
+		t.Error("recently used entry should be kept")
+	}
+	if _, ok := cache.get(c); !ok {
+		t.Error("newest entry should be kept")
+	}
+	if stats := cache.snapshot(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("stats = %+v, want 1 eviction, size 2", stats)
+	}
+}
+
+func TestDecisionCache_Invalidate(t *testing.T) {
+	cache, _ := newTestCache(CacheConfig{Size: 10, TTL: time.Minute})
+
+	alice := cacheKey{"user:alice@example.com", "r", "p"}
+	bob := cacheKey{"user:bob@example.com", "r", "p"}
+
+	cache.put(alice, true)
+	cache.put(bob, true)
+
+	cache.invalidate(func(key cacheKey) bool { return key.principal == "user:alice@example.com" })
+	if _, ok := cache.get(alice); ok {
+		t.Error("alice should be invalidated")
+	}
+	if _, ok := cache.get(bob); !ok {
+		t.Error("bob should still be cached")
+	}
+
+	cache.invalidate(nil)
+	if stats := cache.snapshot(); stats.Size != 0 {
+		t.Errorf("Size = %d after full invalidation, want 0", stats.Size)
+	}
+}
+
+func TestClient_Cache(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		// Grant only "get" permissions
+		var granted []string
+		for _, permission := range req.Permissions {
+			if permission == "secretmanager.secrets.get" {
+				granted = append(granted, permission)
+			}
+		}
+		return &iampb.TestIamPermissionsResponse{Permissions: granted}, nil
+	})
+
+	client, err := NewClient(addr, AuthModeStrict, WithCache(CacheConfig{Size: 100, TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	principal := "user:alice@example.com"
+	resource := "projects/test-project/secrets/test-secret"
+
+	first, err := client.Decide(ctx, principal, resource, "secretmanager.secrets.get")
+	if err != nil || first.Cached || !first.Allowed {
+		t.Fatalf("first Decide() = %+v, %v; want uncached grant", first, err)
+	}
+
+	second, err := client.Decide(ctx, principal, resource, "secretmanager.secrets.get")
+	if err != nil || !second.Cached || !second.Allowed || second.Reason != ReasonGranted {
+		t.Errorf("second Decide() = %+v, %v; want cached grant", second, err)
+	}
+
+	// Denials are cached too, and a batch only asks IAM about misses
+	granted, err := client.CheckPermissions(ctx, principal, resource, []string{
+		"secretmanager.secrets.get",
+		"secretmanager.secrets.delete",
+	})
+	if err != nil || !granted["secretmanager.secrets.get"] || granted["secretmanager.secrets.delete"] {
+		t.Fatalf("CheckPermissions() = %v, %v", granted, err)
+	}
+	denied, _ := client.Decide(ctx, principal, resource, "secretmanager.secrets.delete")
+	if !denied.Cached || denied.Allowed || denied.Reason != ReasonDenied {
+		t.Errorf("Decide(delete) = %+v; want cached denial", denied)
+	}
+
+	if calls := fake.Calls(); calls != 2 {
+		t.Errorf("IAM calls = %d, want 2", calls)
+	}
+
+	client.InvalidatePrincipal("user:bob@example.com")
+	if d, _ := client.Decide(ctx, principal, resource, "secretmanager.secrets.get"); !d.Cached {
+		t.Error("invalidating another principal should keep alice's decisions")
+	}
+
+	client.InvalidatePrincipal(principal)
+	if d, _ := client.Decide(ctx, principal, resource, "secretmanager.secrets.get"); d.Cached {
+		t.Error("InvalidatePrincipal should drop alice's decisions")
+	}
+
+	client.InvalidateCache()
+	if d, _ := client.Decide(ctx, principal, resource, "secretmanager.secrets.get"); d.Cached {
+		t.Error("InvalidateCache should drop every decision")
+	}
+
+	stats := client.CacheStats()
+	if stats.Hits != 4 {
+		t.Errorf("CacheStats().Hits = %d, want 4", stats.Hits)
+	}
+}
+
+func TestClient_CacheSkipsFailures(t *testing.T) {
+	client, err := NewClient("localhost:9999", AuthModePermissive,
+		WithCache(CacheConfig{Size: 100, TTL: time.Minute}),
+		WithTimeout(200*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		d, _ := client.Decide(context.Background(), "user:alice@example.com", "projects/p", "secretmanager.secrets.get")
+		if d.Cached || d.Reason != ReasonFailOpen {
+			t.Errorf("attempt %d: Decide() = %+v; fail-open must never be cached", i, d)
+		}
+	}
+}
+
+func TestClient_CacheDisabled(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	// Invalidation and stats are safe without a cache
+	client.InvalidateCache()
+	client.InvalidatePrincipal("user:alice@example.com")
+	if stats := client.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("CacheStats() = %+v, want zero", stats)
+	}
+}
+
+func TestNewClient_InvalidCache(t *testing.T) {
+	_, err := NewClient(iamEmulatorHost, AuthModeStrict, WithCache(CacheConfig{}))
+	if err == nil {
+		t.Error("NewClient(WithCache(CacheConfig{})) should return error")
+	}
+}
@@ -2,37 +2,108 @@ package emulatorauth
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Client is a lightweight IAM emulator client for permission checks
 type Client struct {
-	client  iampb.IAMPolicyClient
-	conn    *grpc.ClientConn
-	mode    AuthMode
-	timeout time.Duration
+	client        iampb.IAMPolicyClient
+	conn          *grpc.ClientConn
+	setModeMu     sync.Mutex   // serializes SetMode, so changes are reported in order
+	mu            sync.RWMutex // guards mode and timeout
+	mode          AuthMode
+	timeout       time.Duration
+	cache         *decisionCache
+	retry         RetryPolicy
+	breaker       *circuitBreaker
+	errorPolicy   ErrorPolicy
+	auditFunc     AuditFunc
+	auditTrace    *trace.Writer
+	modeOverrides ModeOverrides
+	modeChange    ModeChangeFunc
+
+	anonymousPolicy  AnonymousPolicy
+	defaultPrincipal string
 }
 
 // NewClient creates a new IAM emulator client
-func NewClient(host string, mode AuthMode) (*Client, error) {
-	conn, err := grpc.NewClient(
-		host,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+func NewClient(host string, mode AuthMode, opts ...Option) (*Client, error) {
+	o := defaultClientOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := o.resolve(); err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(host, o.grpcDialOptions()...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		client:  iampb.NewIAMPolicyClient(conn),
-		conn:    conn,
-		mode:    mode,
-		timeout: 2 * time.Second,
-	}, nil
+	c := &Client{
+		client:        iampb.NewIAMPolicyClient(conn),
+		conn:          conn,
+		mode:          mode,
+		timeout:       o.timeout,
+		retry:         o.retry,
+		errorPolicy:   o.errorPolicy,
+		auditFunc:     o.auditFunc,
+		auditTrace:    o.auditTrace,
+		modeOverrides: o.modeOverrides,
+		modeChange:    o.modeChange,
+
+		anonymousPolicy:  o.anonymousPolicy,
+		defaultPrincipal: o.defaultPrincipal,
+	}
+	if o.cache != nil {
+		c.cache = newDecisionCache(*o.cache)
+	}
+	if o.breaker != nil {
+		c.breaker = newCircuitBreaker(*o.breaker)
+	}
+
+	return c, nil
+}
+
+// NewClientFromConfig creates a new IAM emulator client from a Config.
+// Options are applied after the ones derived from the config.
+func NewClientFromConfig(cfg Config, opts ...Option) (*Client, error) {
+	var configOpts []Option
+	if cfg.Timeout > 0 {
+		configOpts = append(configOpts, WithTimeout(cfg.Timeout))
+	}
+	if cfg.TLS.IsEnabled() {
+		configOpts = append(configOpts, WithTLS(cfg.TLS))
+	}
+	if cfg.Retry.IsEnabled() {
+		configOpts = append(configOpts, WithRetry(cfg.Retry))
+	}
+	if cfg.Cache.IsEnabled() {
+		configOpts = append(configOpts, WithCache(cfg.Cache))
+	}
+	if len(cfg.ErrorPolicy) > 0 {
+		configOpts = append(configOpts, WithErrorPolicy(cfg.ErrorPolicy))
+	}
+	if len(cfg.ModeOverrides) > 0 {
+		configOpts = append(configOpts, WithModeOverrides(cfg.ModeOverrides))
+	}
+	if cfg.AnonymousPolicy != "" {
+		configOpts = append(configOpts, WithAnonymousPolicy(cfg.AnonymousPolicy))
+	}
+	if cfg.DefaultPrincipal != "" {
+		configOpts = append(configOpts, WithDefaultPrincipal(cfg.DefaultPrincipal))
+	}
+
+	return NewClient(cfg.Host, cfg.Mode, append(configOpts, opts...)...)
 }
 
 // CheckPermission checks if the principal has the given permission on the resource
@@ -42,39 +113,273 @@ func (c *Client) CheckPermission(
 	resource string,
 	permission string,
 ) (bool, error) {
+	decision, err := c.Decide(ctx, principal, resource, permission)
+	return decision.Allowed, err
+}
+
+// Decide checks if the principal has the given permission on the resource and
+// returns a Decision describing how the outcome was reached. The error is the
+// same one CheckPermission would return.
+func (c *Client) Decide(
+	ctx context.Context,
+	principal string,
+	resource string,
+	permission string,
+) (Decision, error) {
+	decisions, err := c.decide(ctx, principal, resource, []string{permission})
+	return decisions[permission], err
+}
+
+// CheckPermissions checks several permissions on the resource with a single
+// TestIamPermissions call. The returned map has an entry for every requested
+// permission, set to true if it was granted.
+func (c *Client) CheckPermissions(
+	ctx context.Context,
+	principal string,
+	resource string,
+	permissions []string,
+) (map[string]bool, error) {
+	decisions, err := c.decide(ctx, principal, resource, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make(map[string]bool, len(decisions))
+	for permission, decision := range decisions {
+		granted[permission] = decision.Allowed
+	}
+
+	return granted, nil
+}
+
+// decide returns a Decision for every requested permission. Checks in audit
+// mode are always allowed and their would-be denials reported instead.
+func (c *Client) decide(
+	ctx context.Context,
+	principal string,
+	resource string,
+	permissions []string,
+) (map[string]Decision, error) {
+	principal = c.anonymousPrincipal(principal)
+
+	// Use one mode for the whole call, even if SetMode runs concurrently
+	mode := c.Mode()
+	if !mode.IsEnabled() {
+		decisions := make(map[string]Decision, len(permissions))
+		for _, permission := range permissions {
+			decisions[permission] = Decision{
+				Allowed:    true,
+				Reason:     ReasonDisabled,
+				Mode:       mode,
+				Principal:  principal,
+				Resource:   resource,
+				Permission: permission,
+				Status:     status.New(codes.OK, ""),
+			}
+		}
+		return decisions, nil
+	}
+
+	var (
+		decisions map[string]Decision
+		err       error
+	)
+	if _, perr := parseExtractedPrincipal(principal); perr != nil {
+		decisions, err = c.rejectInvalidPrincipal(mode, principal, resource, permissions, perr)
+	} else if principal == "" && c.anonymousPolicy == AnonymousReject {
+		decisions, err = c.rejectAnonymous(mode, resource, permissions)
+	} else {
+		decisions, err = c.evaluate(ctx, mode, principal, resource, permissions)
+	}
+	c.audit(ctx, permissions, decisions)
+
+	if err != nil {
+		// The error only stands if a check outside audit mode was denied by it
+		for _, d := range decisions {
+			if !d.Allowed {
+				return decisions, err
+			}
+		}
+	}
+	return decisions, nil
+}
+
+// rejectInvalidPrincipal denies every permission for a malformed principal
+// without asking IAM, which would only ever deny it, and returns why as an
+// ErrInvalidRequest
+func (c *Client) rejectInvalidPrincipal(mode AuthMode, principal, resource string, permissions []string, err error) (map[string]Decision, error) {
+	st := status.Newf(codes.InvalidArgument, "invalid principal: %v", err)
+
+	decisions := make(map[string]Decision, len(permissions))
+	for _, permission := range permissions {
+		decisions[permission] = Decision{
+			Reason:     ReasonInvalidPrincipal,
+			Mode:       c.modeOverrides.Mode(resource, permission, mode),
+			Principal:  principal,
+			Resource:   resource,
+			Permission: permission,
+			Status:     st,
+		}
+	}
+	return decisions, &Error{Kind: ErrInvalidRequest, Cause: st.Err()}
+}
+
+// evaluate performs at most one TestIamPermissions call and returns a
+// Decision for every requested permission
+func (c *Client) evaluate(
+	ctx context.Context,
+	mode AuthMode,
+	principal string,
+	resource string,
+	permissions []string,
+) (map[string]Decision, error) {
+	decisions := make(map[string]Decision, len(permissions))
+
+	// Serve what we can from the cache and only ask IAM about the rest
+	pending := permissions
+	if c.cache != nil {
+		pending = nil
+		for _, permission := range permissions {
+			allowed, ok := c.cache.get(cacheKey{principal, resource, permission})
+			if !ok {
+				pending = append(pending, permission)
+				continue
+			}
+
+			reason := ReasonDenied
+			if allowed {
+				reason = ReasonGranted
+			}
+			decisions[permission] = Decision{
+				Allowed:    allowed,
+				Reason:     reason,
+				Mode:       c.modeOverrides.Mode(resource, permission, mode),
+				Principal:  principal,
+				Resource:   resource,
+				Permission: permission,
+				Cached:     true,
+				Status:     status.New(codes.OK, ""),
+			}
+		}
+	}
+
+	if len(pending) == 0 {
+		return decisions, nil
+	}
+
 	// Inject principal into outbound metadata
 	ctx = InjectPrincipalToContext(ctx, principal)
 
-	// Apply timeout
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
-	defer cancel()
-
-	resp, err := c.client.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+	req := &iampb.TestIamPermissionsRequest{
 		Resource:    resource,
-		Permissions: []string{permission},
-	})
+		Permissions: pending,
+	}
 
-	if err != nil {
-		// Classify error type
-		if IsConnectivityError(err) {
-			// IAM emulator unreachable/timeout
-			if c.mode == AuthModePermissive {
-				// Fail-open: allow on connectivity issues
-				return true, nil
+	var (
+		resp     *iampb.TestIamPermissionsResponse
+		attempts int
+		err      error
+		action   ErrorAction
+	)
+	start := time.Now()
+	if c.breaker != nil && !c.breaker.allow() {
+		// Breaker open: resolve as unreachable without waiting on IAM
+		err = errBreakerOpen
+		action = ErrorActionFailMode
+	} else {
+		timeout := c.Timeout()
+		attempts, err = c.retry.retry(ctx, c.errorPolicy.transient, func() error {
+			// Apply timeout per attempt
+			attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var err error
+			resp, err = c.client.TestIamPermissions(attemptCtx, req)
+			return err
+		})
+		if c.breaker != nil {
+			if ctx.Err() != nil {
+				// A caller giving up says nothing about IAM health
+				c.breaker.release()
+			} else {
+				c.breaker.record(c.errorPolicy.transient(err))
 			}
-			// Strict mode: fail-closed
-			return false, err
 		}
+		action = c.errorPolicy.Action(status.Code(err))
+	}
+	latency := time.Since(start)
+	err = wrapActionError(err, action)
+
+	st := status.Convert(err)
+	record := func(permission string, allowed bool, reason DecisionReason) {
+		decisions[permission] = Decision{
+			Allowed:    allowed,
+			Reason:     reason,
+			Mode:       c.modeOverrides.Mode(resource, permission, mode),
+			Principal:  principal,
+			Resource:   resource,
+			Permission: permission,
+			Latency:    latency,
+			Attempts:   attempts,
+			Status:     st,
+		}
+	}
 
-		// Config/bad request error: always deny (both modes)
-		// This indicates emulator misconfiguration that should be fixed
-		return false, err
+	if err != nil {
+		// Resolve the error as the policy says for its code
+		switch action {
+		case ErrorActionDeny:
+			// Treated as IAM denying the check
+			for _, permission := range pending {
+				record(permission, false, ReasonDenied)
+			}
+			return decisions, nil
+
+		case ErrorActionFailMode:
+			// IAM emulator unreachable/timeout: fail-open in permissive
+			// mode, fail-closed in strict (and audit) mode
+			failedClosed := false
+			for _, permission := range pending {
+				if c.modeOverrides.Mode(resource, permission, mode) == AuthModePermissive {
+					record(permission, true, ReasonFailOpen)
+				} else {
+					record(permission, false, ReasonFailClosed)
+					failedClosed = true
+				}
+			}
+			if failedClosed {
+				return decisions, err
+			}
+			return decisions, nil
+
+		default:
+			// Config/bad request, permission or authentication error: always
+			// deny (both modes). This indicates emulator misconfiguration that
+			// should be fixed
+			for _, permission := range pending {
+				record(permission, false, ReasonConfigError)
+			}
+			return decisions, err
+		}
 	}
 
-	// Check if permission was granted
-	allowed := len(resp.Permissions) == 1
+	// IAM returns the subset of requested permissions that were granted
+	granted := make(map[string]bool, len(resp.Permissions))
+	for _, permission := range resp.Permissions {
+		granted[permission] = true
+	}
+	for _, permission := range pending {
+		if granted[permission] {
+			record(permission, true, ReasonGranted)
+		} else {
+			record(permission, false, ReasonDenied)
+		}
+		if c.cache != nil {
+			c.cache.put(cacheKey{principal, resource, permission}, granted[permission])
+		}
+	}
 
-	return allowed, nil
+	return decisions, nil
 }
 
 // Close closes the IAM client connection
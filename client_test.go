@@ -2,11 +2,19 @@ package emulatorauth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"sync"
 	"testing"
 	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -100,6 +108,61 @@ func waitForIAMEmulator(host string, timeout time.Duration) bool {
 	return false
 }
 
+// fakeIAMServer is an in-process IAM policy server for tests that need
+// deterministic responses or a transport the IAM emulator binary can't provide
+type fakeIAMServer struct {
+	iampb.UnimplementedIAMPolicyServer
+
+	mu      sync.Mutex
+	calls   int
+	handler func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error)
+}
+
+func (s *fakeIAMServer) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	handler := s.handler
+	s.mu.Unlock()
+
+	if handler == nil {
+		// Grant everything by default
+		return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+	}
+	return handler(ctx, req)
+}
+
+func (s *fakeIAMServer) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func (s *fakeIAMServer) SetHandler(handler func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+}
+
+// startFakeIAMServer starts a fakeIAMServer on a random local port and returns
+// it with its address. The server is stopped when the test finishes.
+func startFakeIAMServer(t *testing.T, opts ...grpc.ServerOption) (*fakeIAMServer, string) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	fake := &fakeIAMServer{}
+	server := grpc.NewServer(opts...)
+	iampb.RegisterIAMPolicyServer(server, fake)
+
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return fake, lis.Addr().String()
+}
+
 func TestNewClient(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -427,3 +490,237 @@ func TestCheckPermission_MultiplePermissions(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckPermissions_MatchesSingleChecks(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	resource := "projects/test-project/secrets/test-secret"
+
+	permissions := []string{
+		"secretmanager.secrets.get",
+		"secretmanager.versions.access",
+		"cloudkms.cryptoKeys.encrypt",
+	}
+
+	granted, err := client.CheckPermissions(ctx, "user:test@example.com", resource, permissions)
+	if err != nil {
+		t.Fatalf("CheckPermissions() error = %v", err)
+	}
+
+	if len(granted) != len(permissions) {
+		t.Errorf("CheckPermissions() returned %d entries, want %d", len(granted), len(permissions))
+	}
+
+	// A batch check must agree with individual checks for every permission
+	for _, permission := range permissions {
+		allowed, err := client.CheckPermission(ctx, "user:test@example.com", resource, permission)
+		if err != nil {
+			t.Fatalf("CheckPermission(%s) error = %v", permission, err)
+		}
+		if granted[permission] != allowed {
+			t.Errorf("CheckPermissions()[%s] = %v, CheckPermission() = %v", permission, granted[permission], allowed)
+		}
+	}
+}
+
+func TestCheckPermissions_Empty(t *testing.T) {
+	// No permissions requested should not require a round trip
+	client, err := NewClient("localhost:9999", AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	granted, err := client.CheckPermissions(context.Background(), "user:test@example.com", "projects/test-project", nil)
+	if err != nil {
+		t.Errorf("CheckPermissions() error = %v", err)
+	}
+	if len(granted) != 0 {
+		t.Errorf("CheckPermissions() = %v, want empty", granted)
+	}
+}
+
+func TestCheckPermissions_Connectivity(t *testing.T) {
+	permissions := []string{"cloudkms.cryptoKeys.encrypt", "cloudkms.cryptoKeys.decrypt"}
+
+	t.Run("permissive allows all", func(t *testing.T) {
+		client, err := NewClient("localhost:9999", AuthModePermissive)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		granted, err := client.CheckPermissions(context.Background(), "user:test@example.com", "projects/test-project", permissions)
+		if err != nil {
+			t.Errorf("Permissive mode should not return error on connectivity failure: %v", err)
+		}
+		for _, permission := range permissions {
+			if !granted[permission] {
+				t.Errorf("Permissive mode should allow %s on connectivity error (fail-open)", permission)
+			}
+		}
+	})
+
+	t.Run("strict denies all", func(t *testing.T) {
+		client, err := NewClient("localhost:9999", AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		granted, err := client.CheckPermissions(context.Background(), "user:test@example.com", "projects/test-project", permissions)
+		if !IsConnectivityError(err) {
+			t.Errorf("Expected connectivity error, got: %v", err)
+		}
+		for _, permission := range permissions {
+			if granted[permission] {
+				t.Errorf("Strict mode should deny %s on connectivity error (fail-closed)", permission)
+			}
+		}
+	})
+}
+
+func TestDecide_Reasons(t *testing.T) {
+	tests := []struct {
+		name        string
+		host        string
+		mode        AuthMode
+		resource    string
+		wantAllowed bool
+		wantReason  DecisionReason
+		wantErr     bool
+	}{
+		{
+			name:        "permissive unreachable fails open",
+			host:        "localhost:9999",
+			mode:        AuthModePermissive,
+			resource:    "projects/test-project/secrets/test-secret",
+			wantAllowed: true,
+			wantReason:  ReasonFailOpen,
+			wantErr:     false,
+		},
+		{
+			name:        "strict unreachable fails closed",
+			host:        "localhost:9999",
+			mode:        AuthModeStrict,
+			resource:    "projects/test-project/secrets/test-secret",
+			wantAllowed: false,
+			wantReason:  ReasonFailClosed,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.host, tt.mode)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			decision, err := client.Decide(context.Background(), "user:test@example.com", tt.resource, "secretmanager.secrets.get")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decide() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if decision.Allowed != tt.wantAllowed {
+				t.Errorf("Decision.Allowed = %v, want %v", decision.Allowed, tt.wantAllowed)
+			}
+			if decision.Reason != tt.wantReason {
+				t.Errorf("Decision.Reason = %v, want %v", decision.Reason, tt.wantReason)
+			}
+			if decision.Mode != tt.mode {
+				t.Errorf("Decision.Mode = %v, want %v", decision.Mode, tt.mode)
+			}
+			if !IsConnectivityError(decision.Status.Err()) {
+				t.Errorf("Decision.Status = %v, want connectivity error", decision.Status)
+			}
+		})
+	}
+}
+
+func TestDecide_Evaluated(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	decision, err := client.Decide(
+		context.Background(),
+		"user:test@example.com",
+		"projects/test-project/secrets/test-secret",
+		"secretmanager.secrets.get",
+	)
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+
+	// Whatever the policy says, a reachable emulator yields a real grant or denial
+	if decision.Reason != ReasonGranted && decision.Reason != ReasonDenied {
+		t.Errorf("Decision.Reason = %v, want granted or denied", decision.Reason)
+	}
+	if decision.Allowed != (decision.Reason == ReasonGranted) {
+		t.Errorf("Decision.Allowed = %v inconsistent with reason %v", decision.Allowed, decision.Reason)
+	}
+	if decision.Status.Code() != codes.OK {
+		t.Errorf("Decision.Status = %v, want OK", decision.Status.Code())
+	}
+	if decision.Permission != "secretmanager.secrets.get" {
+		t.Errorf("Decision.Permission = %q", decision.Permission)
+	}
+}
+
+func TestCheckPermission_TypedErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       codes.Code
+		mode       AuthMode
+		wantKind   error
+		wantReason DecisionReason
+	}{
+		{"PermissionDenied strict", codes.PermissionDenied, AuthModeStrict, ErrPermissionDenied, ReasonConfigError},
+		{"PermissionDenied permissive", codes.PermissionDenied, AuthModePermissive, ErrPermissionDenied, ReasonConfigError},
+		{"Unauthenticated permissive", codes.Unauthenticated, AuthModePermissive, ErrUnauthenticated, ReasonConfigError},
+		{"NotFound permissive", codes.NotFound, AuthModePermissive, ErrInvalidRequest, ReasonConfigError},
+		{"ResourceExhausted permissive", codes.ResourceExhausted, AuthModePermissive, ErrInvalidRequest, ReasonConfigError},
+		{"Unavailable strict", codes.Unavailable, AuthModeStrict, ErrIAMUnavailable, ReasonFailClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, addr := startFakeIAMServer(t)
+			fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+				return nil, status.Error(tt.code, "rejected by test")
+			})
+
+			client, err := NewClient(addr, tt.mode)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			decision, err := client.Decide(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+			if decision.Allowed {
+				t.Error("Decision.Allowed = true, want false")
+			}
+			if decision.Reason != tt.wantReason {
+				t.Errorf("Decision.Reason = %v, want %v", decision.Reason, tt.wantReason)
+			}
+			if !errors.Is(err, tt.wantKind) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", err, tt.wantKind)
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("errors.As(%v, *Error) = false, want true", err)
+			}
+			if got := status.Code(err); got != tt.code {
+				t.Errorf("status.Code(err) = %v, want %v", got, tt.code)
+			}
+		})
+	}
+}
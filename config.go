@@ -1,30 +1,255 @@
 package emulatorauth
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultHost is the IAM emulator endpoint used when none is configured
+const DefaultHost = "localhost:8080"
 
 // Config holds IAM emulator configuration
 type Config struct {
-	// Mode is the authorization mode (off, permissive, strict)
+	// Mode is the authorization mode (off, permissive, strict, audit)
 	Mode AuthMode
 
 	// Host is the IAM emulator gRPC endpoint (host:port)
 	Host string
 
+	// Timeout is the per-check timeout (DefaultTimeout if zero)
+	Timeout time.Duration
+
 	// Trace enables IAM decision logging
 	Trace bool
+
+	// TraceOutput is the trace destination for trace.NewWriter ("stdout" or
+	// a file path); empty disables tracing
+	TraceOutput string
+
+	// TLS configures TLS/mTLS for the IAM emulator connection
+	TLS TLSConfig
+
+	// Retry configures retries of transient IAM errors (disabled by default)
+	Retry RetryPolicy
+
+	// Cache configures the decision cache (disabled by default)
+	Cache CacheConfig
+
+	// ErrorPolicy overrides how gRPC codes from the IAM emulator are resolved
+	// (DefaultErrorPolicy for codes without an entry)
+	ErrorPolicy ErrorPolicy
+
+	// ModeOverrides replaces Mode for matching permissions or resources
+	ModeOverrides ModeOverrides
+
+	// DefaultPrincipal is checked in place of a missing principal
+	DefaultPrincipal string
+
+	// AnonymousPolicy handles checks without a principal when no
+	// DefaultPrincipal is set (AnonymousPassthrough if empty)
+	AnonymousPolicy AnonymousPolicy
 }
 
-// LoadFromEnv loads configuration from environment variables
+// LoadFromEnv loads configuration from environment variables. Invalid values
+// are ignored, so a typo in IAM_MODE silently disables enforcement; prefer
+// LoadFromEnvStrict.
 func LoadFromEnv() Config {
+	cfg := defaultConfig()
+	_ = cfg.applyEnv(os.Getenv, false)
+	return cfg
+}
+
+// LoadFromEnvStrict loads configuration from the same environment variables
+// as LoadFromEnv, but returns an error for unknown modes and other invalid
+// values instead of ignoring them
+func LoadFromEnvStrict() (Config, error) {
+	cfg := defaultConfig()
+	if err := errors.Join(cfg.applyEnv(os.Getenv, true), cfg.Validate()); err != nil {
+		return Config{}, fmt.Errorf("invalid IAM environment: %w", err)
+	}
+	return cfg, nil
+}
+
+func defaultConfig() Config {
 	return Config{
-		Mode:  ParseAuthMode(os.Getenv("IAM_MODE")),
-		Host:  getEnvWithDefault("IAM_EMULATOR_HOST", "localhost:8080"),
-		Trace: os.Getenv("IAM_TRACE") == "true",
+		Mode: AuthModeOff,
+		Host: DefaultHost,
+	}
+}
+
+// applyEnv overrides cfg with the environment variables getenv reports as
+// set. Invalid values are ignored unless strict is true, in which case they
+// are returned as errors.
+func (cfg *Config) applyEnv(getenv func(key string) string, strict bool) error {
+	var errs []error
+	invalid := func(key, value string, err error) {
+		if strict {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", key, value, err))
+		}
+	}
+
+	if v := getenv("IAM_MODE"); v != "" {
+		if strict {
+			// Left for Validate to report if unknown
+			cfg.Mode = normalizeAuthMode(v)
+		} else {
+			cfg.Mode = ParseAuthMode(v)
+		}
+	}
+	cfg.Host = lookupWithDefault(getenv, "IAM_EMULATOR_HOST", cfg.Host)
+	if v := getenv("IAM_TIMEOUT"); v != "" {
+		if timeout, err := time.ParseDuration(v); err != nil {
+			invalid("IAM_TIMEOUT", v, err)
+		} else {
+			cfg.Timeout = timeout
+		}
+	}
+	if v := getenv("IAM_TRACE"); v != "" {
+		cfg.Trace = parseEnvBool("IAM_TRACE", v, strict, invalid)
+	}
+	cfg.TraceOutput = lookupWithDefault(getenv, "IAM_TRACE_OUTPUT", cfg.TraceOutput)
+
+	if v := getenv("IAM_EMULATOR_TLS"); v != "" {
+		cfg.TLS.Enabled = parseEnvBool("IAM_EMULATOR_TLS", v, strict, invalid)
+	}
+	cfg.TLS.CAFile = lookupWithDefault(getenv, "IAM_EMULATOR_TLS_CA", cfg.TLS.CAFile)
+	cfg.TLS.CertFile = lookupWithDefault(getenv, "IAM_EMULATOR_TLS_CERT", cfg.TLS.CertFile)
+	cfg.TLS.KeyFile = lookupWithDefault(getenv, "IAM_EMULATOR_TLS_KEY", cfg.TLS.KeyFile)
+	cfg.TLS.ServerName = lookupWithDefault(getenv, "IAM_EMULATOR_TLS_SERVER_NAME", cfg.TLS.ServerName)
+
+	// Retries use the default policy, tuned by attempts and initial backoff
+	if v := getenv("IAM_RETRY_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			invalid("IAM_RETRY_MAX_ATTEMPTS", v, err)
+		case attempts > 1:
+			if !cfg.Retry.IsEnabled() {
+				cfg.Retry = DefaultRetryPolicy()
+			}
+			cfg.Retry.MaxAttempts = attempts
+		default:
+			cfg.Retry = RetryPolicy{}
+		}
+	}
+	if v := getenv("IAM_RETRY_INITIAL_BACKOFF"); v != "" {
+		backoff, err := time.ParseDuration(v)
+		switch {
+		case err == nil && backoff <= 0:
+			err = errors.New("must be positive")
+		case err == nil && !cfg.Retry.IsEnabled():
+			// Likely a missing or mistyped IAM_RETRY_MAX_ATTEMPTS
+			err = errors.New("has no effect unless IAM_RETRY_MAX_ATTEMPTS is above 1")
+		}
+		if err != nil {
+			invalid("IAM_RETRY_INITIAL_BACKOFF", v, err)
+		} else {
+			cfg.Retry.InitialBackoff = backoff
+			cfg.Retry.MaxBackoff = max(cfg.Retry.MaxBackoff, backoff)
+		}
+	}
+
+	if v := getenv("IAM_ERROR_POLICY"); v != "" {
+		if policy, err := ParseErrorPolicy(v); err != nil {
+			invalid("IAM_ERROR_POLICY", v, err)
+		} else if len(policy) > 0 {
+			cfg.ErrorPolicy = policy
+		}
+	}
+
+	if v := getenv("IAM_MODE_OVERRIDES"); v != "" {
+		if overrides, err := ParseModeOverrides(v); err != nil {
+			invalid("IAM_MODE_OVERRIDES", v, err)
+		} else {
+			cfg.ModeOverrides = overrides
+		}
+	}
+
+	if v := getenv("IAM_DEFAULT_PRINCIPAL"); v != "" {
+		if _, err := ParsePrincipal(v); err != nil {
+			invalid("IAM_DEFAULT_PRINCIPAL", v, err)
+		} else {
+			cfg.DefaultPrincipal = v
+		}
+	}
+	if v := getenv("IAM_ANONYMOUS_POLICY"); v != "" {
+		policy := parseAnonymousPolicy(v)
+		if err := policy.validate(); err != nil {
+			invalid("IAM_ANONYMOUS_POLICY", v, err)
+		} else {
+			cfg.AnonymousPolicy = policy
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseEnvBool parses a boolean variable. Outside strict mode only "true"
+// enables it, as LoadFromEnv always has.
+func parseEnvBool(key, value string, strict bool, invalid func(key, value string, err error)) bool {
+	if !strict {
+		return value == "true"
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		invalid(key, value, errors.New("want true or false"))
+	}
+	return b
+}
+
+// Validate reports every invalid setting, naming the setting and the
+// accepted values, e.g. an unknown mode instead of silently using off
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if !cfg.Mode.isValid() {
+		errs = append(errs, fmt.Errorf("mode: unknown value %q (want off, permissive, strict or audit)", cfg.Mode))
+	}
+	if cfg.Mode.IsEnabled() && cfg.Host == "" {
+		errs = append(errs, fmt.Errorf("host: must be set when mode is %s", cfg.Mode))
+	}
+	if cfg.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout: must not be negative, got %v", cfg.Timeout))
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: client certificate and key must be set together"))
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("retry: %w", err))
+	}
+	if cfg.Cache.IsEnabled() {
+		if err := cfg.Cache.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cache: %w", err))
+		}
 	}
+	if err := cfg.ErrorPolicy.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("error_policy: %w", err))
+	}
+	if err := cfg.ModeOverrides.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("mode_overrides: %w", err))
+	}
+	if cfg.DefaultPrincipal != "" {
+		if _, err := ParsePrincipal(cfg.DefaultPrincipal); err != nil {
+			errs = append(errs, fmt.Errorf("default_principal: %w", err))
+		}
+	}
+	if err := cfg.AnonymousPolicy.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("anonymous_policy: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
 func getEnvWithDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	return lookupWithDefault(os.Getenv, key, defaultValue)
+}
+
+func lookupWithDefault(getenv func(key string) string, key, defaultValue string) string {
+	if value := getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
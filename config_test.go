@@ -2,7 +2,11 @@ package emulatorauth
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
 func TestLoadFromEnv(t *testing.T) {
@@ -132,6 +136,126 @@ func TestLoadFromEnv(t *testing.T) {
 	os.Clearenv()
 }
 
+func TestLoadFromEnv_TLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected TLSConfig
+	}{
+		{
+			name:     "plaintext by default",
+			env:      map[string]string{},
+			expected: TLSConfig{},
+		},
+		{
+			name: "system roots",
+			env: map[string]string{
+				"IAM_EMULATOR_TLS": "true",
+			},
+			expected: TLSConfig{Enabled: true},
+		},
+		{
+			name: "mTLS",
+			env: map[string]string{
+				"IAM_EMULATOR_TLS_CA":          "/certs/ca.pem",
+				"IAM_EMULATOR_TLS_CERT":        "/certs/client.pem",
+				"IAM_EMULATOR_TLS_KEY":         "/certs/client-key.pem",
+				"IAM_EMULATOR_TLS_SERVER_NAME": "iam.internal",
+			},
+			expected: TLSConfig{
+				CAFile:     "/certs/ca.pem",
+				CertFile:   "/certs/client.pem",
+				KeyFile:    "/certs/client-key.pem",
+				ServerName: "iam.internal",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			got := LoadFromEnv()
+			if got.TLS != tt.expected {
+				t.Errorf("TLS = %+v, want %+v", got.TLS, tt.expected)
+			}
+		})
+	}
+
+	os.Clearenv()
+}
+
+func TestLoadFromEnv_Retry(t *testing.T) {
+	withAttempts := func(attempts int, backoff time.Duration) RetryPolicy {
+		policy := DefaultRetryPolicy()
+		policy.MaxAttempts = attempts
+		if backoff > 0 {
+			policy.InitialBackoff = backoff
+		}
+		return policy
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected RetryPolicy
+	}{
+		{
+			name:     "disabled by default",
+			env:      map[string]string{},
+			expected: RetryPolicy{},
+		},
+		{
+			name: "attempts",
+			env: map[string]string{
+				"IAM_RETRY_MAX_ATTEMPTS": "5",
+			},
+			expected: withAttempts(5, 0),
+		},
+		{
+			name: "attempts and backoff",
+			env: map[string]string{
+				"IAM_RETRY_MAX_ATTEMPTS":    "3",
+				"IAM_RETRY_INITIAL_BACKOFF": "250ms",
+			},
+			expected: withAttempts(3, 250*time.Millisecond),
+		},
+		{
+			name: "single attempt stays disabled",
+			env: map[string]string{
+				"IAM_RETRY_MAX_ATTEMPTS": "1",
+			},
+			expected: RetryPolicy{},
+		},
+		{
+			name: "invalid attempts ignored",
+			env: map[string]string{
+				"IAM_RETRY_MAX_ATTEMPTS": "lots",
+			},
+			expected: RetryPolicy{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			got := LoadFromEnv()
+			if got.Retry != tt.expected {
+				t.Errorf("Retry = %+v, want %+v", got.Retry, tt.expected)
+			}
+		})
+	}
+
+	os.Clearenv()
+}
+
 func TestGetEnvWithDefault(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -180,3 +304,147 @@ func TestGetEnvWithDefault(t *testing.T) {
 
 	os.Clearenv()
 }
+
+func TestLoadFromEnv_ErrorPolicy(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("IAM_ERROR_POLICY", "RESOURCE_EXHAUSTED=fail_mode,NOT_FOUND=deny")
+	got := LoadFromEnv()
+	if got.ErrorPolicy[codes.ResourceExhausted] != ErrorActionFailMode || got.ErrorPolicy[codes.NotFound] != ErrorActionDeny {
+		t.Errorf("ErrorPolicy = %v", got.ErrorPolicy)
+	}
+
+	// Invalid policies keep the default classification
+	os.Setenv("IAM_ERROR_POLICY", "NOT_FOUND=maybe")
+	if got := LoadFromEnv(); got.ErrorPolicy != nil {
+		t.Errorf("ErrorPolicy = %v, want nil for invalid value", got.ErrorPolicy)
+	}
+}
+
+func TestLoadFromEnv_ModeOverrides(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("IAM_MODE_OVERRIDES", "secretmanager.versions.*=strict,*.list=permissive")
+	got := LoadFromEnv()
+	if len(got.ModeOverrides) != 2 || got.ModeOverrides[1] != (ModeOverride{Pattern: "*.list", Mode: AuthModePermissive}) {
+		t.Errorf("ModeOverrides = %v", got.ModeOverrides)
+	}
+
+	os.Setenv("IAM_MODE_OVERRIDES", "*.list=sometimes")
+	if got := LoadFromEnv(); got.ModeOverrides != nil {
+		t.Errorf("ModeOverrides = %v, want nil for invalid value", got.ModeOverrides)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr []string
+	}{
+		{"defaults", defaultConfig(), nil},
+		{"unknown mode", Config{Mode: "strcit", Host: DefaultHost}, []string{`mode: unknown value "strcit"`}},
+		{"missing host", Config{Mode: AuthModeStrict}, []string{"host: must be set"}},
+		{"negative timeout", Config{Mode: AuthModeOff, Timeout: -time.Second}, []string{"timeout"}},
+		{"half mTLS", Config{Mode: AuthModeOff, TLS: TLSConfig{CertFile: "client.pem"}}, []string{"tls:"}},
+		{"bad retry", Config{Mode: AuthModeOff, Retry: RetryPolicy{MaxAttempts: 3}}, []string{"retry:"}},
+		{
+			name:    "every error reported",
+			cfg:     Config{Mode: "bogus", Cache: CacheConfig{TTL: time.Minute}, ErrorPolicy: ErrorPolicy{codes.NotFound: "allow"}},
+			wantErr: []string{"mode:", "cache:", "error_policy:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFromEnvStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantMode AuthMode
+		wantErr  string
+	}{
+		{"defaults", map[string]string{}, AuthModeOff, ""},
+		{"valid", map[string]string{"IAM_MODE": "Strict", "IAM_RETRY_MAX_ATTEMPTS": "3"}, AuthModeStrict, ""},
+		{"typo", map[string]string{"IAM_MODE": "strcit"}, "", `unknown value "strcit"`},
+		{"bad retry", map[string]string{"IAM_MODE": "strict", "IAM_RETRY_MAX_ATTEMPTS": "lots"}, "", "IAM_RETRY_MAX_ATTEMPTS"},
+		{"backoff without retries", map[string]string{"IAM_RETRY_INITIAL_BACKOFF": "200ms"}, "", "IAM_RETRY_INITIAL_BACKOFF"},
+		{"backoff with retries disabled", map[string]string{"IAM_RETRY_MAX_ATTEMPTS": "1", "IAM_RETRY_INITIAL_BACKOFF": "200ms"}, "", "has no effect"},
+		{"bad overrides", map[string]string{"IAM_MODE_OVERRIDES": "*.list=sometimes"}, "", "IAM_MODE_OVERRIDES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			defer os.Clearenv()
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			got, err := LoadFromEnvStrict()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadFromEnvStrict() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFromEnvStrict() error = %v", err)
+			}
+			if got.Mode != tt.wantMode {
+				t.Errorf("Mode = %v, want %v", got.Mode, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_AnonymousPrincipal(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("IAM_DEFAULT_PRINCIPAL", "user:dev@example.com")
+	os.Setenv("IAM_ANONYMOUS_POLICY", "REJECT")
+
+	cfg := LoadFromEnv()
+	if cfg.DefaultPrincipal != "user:dev@example.com" {
+		t.Errorf("DefaultPrincipal = %q, want user:dev@example.com", cfg.DefaultPrincipal)
+	}
+	if cfg.AnonymousPolicy != AnonymousReject {
+		t.Errorf("AnonymousPolicy = %q, want reject", cfg.AnonymousPolicy)
+	}
+
+	// Invalid values are ignored by LoadFromEnv and reported by the strict variant
+	os.Setenv("IAM_DEFAULT_PRINCIPAL", "dev@example.com")
+	os.Setenv("IAM_ANONYMOUS_POLICY", "ignore")
+
+	cfg = LoadFromEnv()
+	if cfg.DefaultPrincipal != "" || cfg.AnonymousPolicy != "" {
+		t.Errorf("invalid values not ignored: %q, %q", cfg.DefaultPrincipal, cfg.AnonymousPolicy)
+	}
+
+	_, err := LoadFromEnvStrict()
+	if err == nil || !strings.Contains(err.Error(), "IAM_DEFAULT_PRINCIPAL") || !strings.Contains(err.Error(), "IAM_ANONYMOUS_POLICY") {
+		t.Errorf("LoadFromEnvStrict() error = %v, want both variables reported", err)
+	}
+}
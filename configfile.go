@@ -0,0 +1,229 @@
+package emulatorauth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the YAML/JSON form of Config read by LoadFromFile:
+//
+//	mode: strict
+//	host: iam-emulator:8080
+//	timeout: 5s
+//	trace_output: ./authz.jsonl
+//	tls:
+//	  ca_file: /certs/ca.pem
+//	retry:
+//	  max_attempts: 4
+//	cache:
+//	  size: 1000
+//	  ttl: 30s
+//	mode_overrides:
+//	  - pattern: "*.list"
+//	    mode: permissive
+//	error_policy:
+//	  NOT_FOUND: deny
+//	anonymous_policy: reject
+type fileConfig struct {
+	Mode          string             `yaml:"mode"`
+	Host          string             `yaml:"host"`
+	Timeout       time.Duration      `yaml:"timeout"`
+	Trace         bool               `yaml:"trace"`
+	TraceOutput   string             `yaml:"trace_output"`
+	TLS           fileTLSConfig      `yaml:"tls"`
+	Retry         *fileRetryPolicy   `yaml:"retry"`
+	Cache         *fileCacheConfig   `yaml:"cache"`
+	ModeOverrides []fileModeOverride `yaml:"mode_overrides"`
+	ErrorPolicy   map[string]string  `yaml:"error_policy"`
+
+	DefaultPrincipal string `yaml:"default_principal"`
+	AnonymousPolicy  string `yaml:"anonymous_policy"`
+}
+
+type fileTLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+// fileRetryPolicy fields left unset keep their DefaultRetryPolicy value
+type fileRetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+	Jitter         float64       `yaml:"jitter"`
+}
+
+type fileCacheConfig struct {
+	Size        int           `yaml:"size"`
+	TTL         time.Duration `yaml:"ttl"`
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+}
+
+type fileModeOverride struct {
+	Pattern string `yaml:"pattern"`
+	Mode    string `yaml:"mode"`
+}
+
+// LoadFromFile loads configuration from a YAML or JSON file, then applies the
+// environment variables read by LoadFromEnv, which take precedence. Unlike
+// LoadFromEnv, unknown keys, invalid values and anything Validate rejects are
+// returned as errors.
+func LoadFromFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	cfg, fileErr := fc.config()
+	envErr := cfg.applyEnv(os.Getenv, true)
+	if err := errors.Join(fileErr, envErr, cfg.Validate()); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// LoadFromEnvFile loads configuration from a dotenv-style file of the
+// variables read by LoadFromEnv:
+//
+//	# comments and blank lines are ignored
+//	IAM_MODE=strict
+//	export IAM_TIMEOUT="5s"
+//
+// Variables in the file take precedence over the process environment. As with
+// LoadFromEnvStrict, invalid values are returned as errors.
+func LoadFromEnvFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	vars, err := parseEnvFile(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse env file %s: %w", path, err)
+	}
+
+	cfg := defaultConfig()
+	getenv := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+	if err := errors.Join(cfg.applyEnv(getenv, true), cfg.Validate()); err != nil {
+		return Config{}, fmt.Errorf("invalid env file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func parseEnvFile(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", i+1)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// config converts the file form into a Config on top of the defaults
+func (fc fileConfig) config() (Config, error) {
+	cfg := defaultConfig()
+	var errs []error
+
+	if fc.Mode != "" {
+		// Left for Validate to report if unknown
+		cfg.Mode = normalizeAuthMode(fc.Mode)
+	}
+	if fc.Host != "" {
+		cfg.Host = fc.Host
+	}
+	cfg.Timeout = fc.Timeout
+	cfg.Trace = fc.Trace
+	cfg.TraceOutput = fc.TraceOutput
+	cfg.TLS = TLSConfig(fc.TLS)
+
+	if r := fc.Retry; r != nil && r.MaxAttempts <= 1 &&
+		(r.InitialBackoff != 0 || r.MaxBackoff != 0 || r.Multiplier != 0 || r.Jitter != 0) {
+		// Likely a missing or mistyped max_attempts
+		errs = append(errs, fmt.Errorf("retry: backoff settings have no effect unless max_attempts is above 1 (got %d)", r.MaxAttempts))
+	}
+	if fc.Retry != nil && fc.Retry.MaxAttempts > 1 {
+		cfg.Retry = DefaultRetryPolicy()
+		cfg.Retry.MaxAttempts = fc.Retry.MaxAttempts
+		if fc.Retry.InitialBackoff != 0 {
+			cfg.Retry.InitialBackoff = fc.Retry.InitialBackoff
+			cfg.Retry.MaxBackoff = max(cfg.Retry.MaxBackoff, fc.Retry.InitialBackoff)
+		}
+		if fc.Retry.MaxBackoff != 0 {
+			cfg.Retry.MaxBackoff = fc.Retry.MaxBackoff
+		}
+		if fc.Retry.Multiplier != 0 {
+			cfg.Retry.Multiplier = fc.Retry.Multiplier
+		}
+		if fc.Retry.Jitter != 0 {
+			cfg.Retry.Jitter = fc.Retry.Jitter
+		}
+	}
+
+	if fc.Cache != nil {
+		cfg.Cache = CacheConfig(*fc.Cache)
+	}
+
+	for _, override := range fc.ModeOverrides {
+		cfg.ModeOverrides = append(cfg.ModeOverrides, ModeOverride{
+			Pattern: override.Pattern,
+			Mode:    normalizeAuthMode(override.Mode),
+		})
+	}
+
+	if len(fc.ErrorPolicy) > 0 {
+		cfg.ErrorPolicy = ErrorPolicy{}
+		for name, action := range fc.ErrorPolicy {
+			code, err := parseCode(name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error_policy: %w", err))
+				continue
+			}
+			cfg.ErrorPolicy[code] = parseErrorAction(action)
+		}
+	}
+
+	// Left for Validate to report if invalid
+	cfg.DefaultPrincipal = fc.DefaultPrincipal
+	cfg.AnonymousPolicy = parseAnonymousPolicy(fc.AnonymousPolicy)
+
+	return cfg, errors.Join(errs...)
+}
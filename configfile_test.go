@@ -0,0 +1,258 @@
+package emulatorauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// writeConfigFile writes a config file into a temp dir and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFromFile_YAML(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	path := writeConfigFile(t, "iam.yaml", `
+mode: Strict
+host: iam-emulator:9000
+timeout: 5s
+trace: true
+trace_output: ./authz.jsonl
+tls:
+  ca_file: /certs/ca.pem
+  server_name: iam.internal
+retry:
+  max_attempts: 3
+  initial_backoff: 250ms
+cache:
+  size: 100
+  ttl: 30s
+  negative_ttl: 5s
+mode_overrides:
+  - pattern: secretmanager.versions.*
+    mode: strict
+  - pattern: "*.list"
+    mode: permissive
+error_policy:
+  RESOURCE_EXHAUSTED: fail_mode
+  not_found: deny
+anonymous_policy: all_users
+`)
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+
+	if cfg.Mode != AuthModeStrict || cfg.Host != "iam-emulator:9000" || cfg.Timeout != 5*time.Second {
+		t.Errorf("mode/host/timeout = %v/%v/%v", cfg.Mode, cfg.Host, cfg.Timeout)
+	}
+	if !cfg.Trace || cfg.TraceOutput != "./authz.jsonl" {
+		t.Errorf("trace = %v/%q", cfg.Trace, cfg.TraceOutput)
+	}
+	if cfg.TLS != (TLSConfig{CAFile: "/certs/ca.pem", ServerName: "iam.internal"}) {
+		t.Errorf("TLS = %+v", cfg.TLS)
+	}
+
+	wantRetry := DefaultRetryPolicy()
+	wantRetry.MaxAttempts = 3
+	wantRetry.InitialBackoff = 250 * time.Millisecond
+	if cfg.Retry != wantRetry {
+		t.Errorf("Retry = %+v, want %+v", cfg.Retry, wantRetry)
+	}
+	if cfg.Cache != (CacheConfig{Size: 100, TTL: 30 * time.Second, NegativeTTL: 5 * time.Second}) {
+		t.Errorf("Cache = %+v", cfg.Cache)
+	}
+	if len(cfg.ModeOverrides) != 2 || cfg.ModeOverrides[1] != (ModeOverride{Pattern: "*.list", Mode: AuthModePermissive}) {
+		t.Errorf("ModeOverrides = %v", cfg.ModeOverrides)
+	}
+	if cfg.ErrorPolicy[codes.ResourceExhausted] != ErrorActionFailMode || cfg.ErrorPolicy[codes.NotFound] != ErrorActionDeny {
+		t.Errorf("ErrorPolicy = %v", cfg.ErrorPolicy)
+	}
+	if cfg.AnonymousPolicy != AnonymousAllUsers {
+		t.Errorf("AnonymousPolicy = %q, want all_users", cfg.AnonymousPolicy)
+	}
+}
+
+func TestLoadFromFile_JSON(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	path := writeConfigFile(t, "iam.json", `{"mode": "permissive", "timeout": "1s", "tls": {"enabled": true}}`)
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if cfg.Mode != AuthModePermissive || cfg.Host != DefaultHost || cfg.Timeout != time.Second || !cfg.TLS.Enabled {
+		t.Errorf("LoadFromFile() = %+v", cfg)
+	}
+}
+
+func TestLoadFromFile_EnvPrecedence(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	path := writeConfigFile(t, "iam.yaml", `
+mode: permissive
+host: from-file:8080
+timeout: 5s
+retry:
+  max_attempts: 3
+`)
+
+	os.Setenv("IAM_MODE", "strict")
+	os.Setenv("IAM_TIMEOUT", "1s")
+	os.Setenv("IAM_RETRY_INITIAL_BACKOFF", "50ms")
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if cfg.Mode != AuthModeStrict || cfg.Timeout != time.Second {
+		t.Errorf("mode/timeout = %v/%v, want env values", cfg.Mode, cfg.Timeout)
+	}
+	if cfg.Host != "from-file:8080" {
+		t.Errorf("Host = %q, want file value", cfg.Host)
+	}
+	if cfg.Retry.MaxAttempts != 3 || cfg.Retry.InitialBackoff != 50*time.Millisecond {
+		t.Errorf("Retry = %+v, want file attempts with env backoff", cfg.Retry)
+	}
+}
+
+func TestLoadFromFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{"unknown mode", "mode: strcit\n", nil, `mode: unknown value "strcit"`},
+		{"unknown key", "mdoe: strict\n", nil, "field mdoe not found"},
+		{"bad duration", "timeout: soon\n", nil, "failed to parse"},
+		{"unknown env mode", "mode: strict\n", map[string]string{"IAM_MODE": "stirct"}, `mode: unknown value "stirct"`},
+		{"bad env timeout", "", map[string]string{"IAM_TIMEOUT": "5"}, "IAM_TIMEOUT"},
+		{"bad env bool", "", map[string]string{"IAM_TRACE": "yes"}, "IAM_TRACE"},
+		{"unknown error code", "error_policy:\n  NOT_A_CODE: deny\n", nil, "NOT_A_CODE"},
+		{"unknown override mode", "mode_overrides:\n  - pattern: \"*.list\"\n    mode: off\n", nil, "mode_overrides"},
+		{"invalid cache", "cache:\n  ttl: 1m\n", nil, "cache: cache size must be positive"},
+		{"retry without max attempts", "retry:\n  initial_backoff: 200ms\n", nil, "retry: backoff settings have no effect"},
+		{"retry with single attempt", "retry:\n  max_attempts: 1\n  jitter: 0.5\n", nil, "max_attempts is above 1 (got 1)"},
+		{"invalid default principal", "default_principal: dev@example.com\n", nil, "default_principal: principal"},
+		{"unknown anonymous policy", "anonymous_policy: ignore\n", nil, "anonymous_policy: unknown anonymous policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			defer os.Clearenv()
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			_, err := LoadFromFile(writeConfigFile(t, "iam.yaml", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFromFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFromFile() should fail for a missing file")
+	}
+}
+
+func TestLoadFromFile_Empty(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	cfg, err := LoadFromFile(writeConfigFile(t, "iam.yaml", ""))
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if cfg.Mode != AuthModeOff || cfg.Host != DefaultHost {
+		t.Errorf("LoadFromFile() = %+v, want defaults", cfg)
+	}
+}
+
+func TestLoadFromEnvFile(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("IAM_MODE", "permissive")
+	os.Setenv("IAM_EMULATOR_HOST", "env-host:8080")
+
+	path := writeConfigFile(t, "iam.env", `
+# test phase 2
+IAM_MODE=strict
+export IAM_TIMEOUT="5s"
+IAM_MODE_OVERRIDES='*.list=permissive'
+`)
+
+	cfg, err := LoadFromEnvFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromEnvFile() error = %v", err)
+	}
+
+	// The file wins over the process environment, which fills the gaps
+	if cfg.Mode != AuthModeStrict {
+		t.Errorf("Mode = %v, want strict", cfg.Mode)
+	}
+	if cfg.Host != "env-host:8080" {
+		t.Errorf("Host = %v, want env-host:8080", cfg.Host)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", cfg.Timeout)
+	}
+	if len(cfg.ModeOverrides) != 1 || cfg.ModeOverrides[0].Pattern != "*.list" {
+		t.Errorf("ModeOverrides = %+v, want *.list=permissive", cfg.ModeOverrides)
+	}
+
+	for name, content := range map[string]string{
+		"no separator": "IAM_MODE strict\n",
+		"unknown mode": "IAM_MODE=lenient\n",
+		"bad timeout":  "IAM_TIMEOUT=soon\n",
+	} {
+		if _, err := LoadFromEnvFile(writeConfigFile(t, "iam.env", content)); err == nil {
+			t.Errorf("%s: LoadFromEnvFile() should fail", name)
+		}
+	}
+}
+
+func TestNewClientFromConfig_TimeoutAndCache(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+
+	client, err := NewClientFromConfig(Config{
+		Mode:    AuthModeStrict,
+		Host:    addr,
+		Timeout: 500 * time.Millisecond,
+		Cache:   CacheConfig{Size: 10, TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("NewClientFromConfig() error = %v", err)
+	}
+	defer client.Close()
+
+	if client.timeout != 500*time.Millisecond {
+		t.Errorf("timeout = %v, want 500ms", client.timeout)
+	}
+	for i := 0; i < 2; i++ {
+		_, _ = client.CheckPermission(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+	}
+	if fake.Calls() != 1 {
+		t.Errorf("IAM calls = %d, want 1 with the cache enabled", fake.Calls())
+	}
+}
@@ -0,0 +1,34 @@
+package emulatorauth
+
+import "context"
+
+type principalContextKey struct{}
+
+type decisionContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the caller's principal for
+// downstream handlers and logging. Unlike InjectPrincipalToContext it is not
+// gRPC metadata, so it works the same for HTTP and gRPC and is never sent on.
+// The interceptors and middleware set it for every checked request.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// WithDecision returns a copy of ctx carrying the IAM decision that let the
+// request through. The interceptors and middleware set it for every checked
+// request.
+func WithDecision(ctx context.Context, d Decision) context.Context {
+	return context.WithValue(ctx, decisionContextKey{}, d)
+}
+
+// DecisionFromContext returns the decision set by WithDecision
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionContextKey{}).(Decision)
+	return d, ok
+}
@@ -0,0 +1,104 @@
+package emulatorauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+)
+
+func TestPrincipalContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := PrincipalFromContext(ctx); ok {
+		t.Error("PrincipalFromContext() found a principal in an empty context")
+	}
+	if _, ok := DecisionFromContext(ctx); ok {
+		t.Error("DecisionFromContext() found a decision in an empty context")
+	}
+
+	want := Principal{Type: PrincipalTypeUser, ID: "alice@example.com"}
+	ctx = WithDecision(WithPrincipal(ctx, want), Decision{Allowed: true, Reason: ReasonGranted})
+
+	if got, ok := PrincipalFromContext(ctx); !ok || got != want {
+		t.Errorf("PrincipalFromContext() = %+v, %v; want %+v", got, ok, want)
+	}
+	if got, ok := DecisionFromContext(ctx); !ok || got.Reason != ReasonGranted {
+		t.Errorf("DecisionFromContext() = %+v, %v; want granted", got, ok)
+	}
+
+	// Never sent on as gRPC metadata
+	if principal := outgoingPrincipal(ctx); principal != "" {
+		t.Errorf("outgoing principal = %q, want none", principal)
+	}
+}
+
+// checkEnforcedContext checks that ctx carries alice and a granted decision
+// on resource
+func checkEnforcedContext(t *testing.T, ctx context.Context, resource string) {
+	t.Helper()
+
+	if p, ok := PrincipalFromContext(ctx); !ok || p.String() != "user:alice@example.com" {
+		t.Errorf("PrincipalFromContext() = %v, %v; want user:alice@example.com", p, ok)
+	}
+	if d, ok := DecisionFromContext(ctx); !ok || !d.Allowed || d.Reason != ReasonGranted || d.Resource != resource {
+		t.Errorf("DecisionFromContext() = %+v, %v; want granted on %s", d, ok, resource)
+	}
+}
+
+func TestEnforcement_PopulatesContext(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+
+	t.Run("unary", func(t *testing.T) {
+		handler := func(ctx context.Context, req any) (any, error) {
+			checkEnforcedContext(t, ctx, "projects/test-project")
+			return "ok", nil
+		}
+
+		_, err := UnaryServerInterceptor(client, testRules)(incomingPrincipal("user:alice@example.com"),
+			&iampb.GetIamPolicyRequest{Resource: "projects/test-project"}, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+		if err != nil {
+			t.Fatalf("interceptor error = %v", err)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		ss := &fakeServerStream{
+			ctx:      incomingPrincipal("user:alice@example.com"),
+			requests: []*iampb.GetIamPolicyRequest{{Resource: "projects/test-project"}},
+		}
+		handler := func(srv any, ss grpc.ServerStream) error {
+			if _, ok := PrincipalFromContext(ss.Context()); ok {
+				t.Error("principal set before the stream was checked")
+			}
+			if err := ss.RecvMsg(&iampb.GetIamPolicyRequest{}); err != nil {
+				return err
+			}
+			checkEnforcedContext(t, ss.Context(), "projects/test-project")
+			return nil
+		}
+
+		if err := StreamServerInterceptor(client, testRules)(nil, ss, &grpc.StreamServerInfo{FullMethod: testMethod}, handler); err != nil {
+			t.Fatalf("interceptor error = %v", err)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			checkEnforcedContext(t, r.Context(), "projects/test-project/secrets/db-password")
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+		req.Header.Set(PrincipalHeaderKey, "user:alice@example.com")
+		Middleware(client, testRoutes)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+		if !called {
+			t.Fatal("handler not called")
+		}
+	})
+}
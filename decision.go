@@ -0,0 +1,117 @@
+package emulatorauth
+
+import (
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc/status"
+)
+
+// DecisionReason explains how a Decision was reached
+type DecisionReason string
+
+const (
+	// ReasonGranted means IAM evaluated the check and granted the permission
+	ReasonGranted DecisionReason = "granted"
+
+	// ReasonDenied means IAM evaluated the check and denied the permission, or
+	// returned an error the ErrorPolicy resolves as a denial
+	ReasonDenied DecisionReason = "denied"
+
+	// ReasonFailOpen means IAM was unreachable and permissive mode allowed the check
+	ReasonFailOpen DecisionReason = "fail_open"
+
+	// ReasonFailClosed means IAM was unreachable and strict mode denied the check
+	ReasonFailClosed DecisionReason = "fail_closed"
+
+	// ReasonConfigError means IAM rejected the check as invalid (always denied)
+	ReasonConfigError DecisionReason = "config_error"
+
+	// ReasonDisabled means the client mode is off and the check was allowed
+	// without asking IAM
+	ReasonDisabled DecisionReason = "disabled"
+
+	// ReasonUnauthenticated means the check had no principal and
+	// AnonymousReject denied it without asking IAM
+	ReasonUnauthenticated DecisionReason = "unauthenticated"
+
+	// ReasonInvalidPrincipal means the principal is not a valid IAM member
+	// (see ParsePrincipal) and the check was denied without asking IAM
+	ReasonInvalidPrincipal DecisionReason = "invalid_principal"
+)
+
+// Decision is the structured result of a permission check
+type Decision struct {
+	// Allowed reports whether the caller should proceed
+	Allowed bool
+
+	// WouldDeny is true when audit mode allowed a check that Reason denies
+	WouldDeny bool
+
+	// Reason distinguishes a real grant or denial from a fail-open/fail-closed
+	// outcome or a configuration error
+	Reason DecisionReason
+
+	// Mode is the auth mode that was applied
+	Mode AuthMode
+
+	Principal  string
+	Resource   string
+	Permission string
+
+	// Latency is the time spent waiting on the IAM emulator (zero if cached)
+	Latency time.Duration
+
+	// Cached is true if the decision was served from the client cache
+	Cached bool
+
+	// Attempts is the number of IAM calls made, including retries
+	// (zero if cached or short-circuited by the circuit breaker)
+	Attempts int
+
+	// Status is the gRPC status returned by the IAM emulator (OK on success)
+	Status *status.Status
+}
+
+// Trace returns the decision in the pkg/trace schema
+func (d Decision) Trace() *trace.Decision {
+	outcome := trace.OutcomeDeny
+	if d.Allowed {
+		outcome = trace.OutcomeAllow
+	}
+
+	return &trace.Decision{
+		Outcome:   outcome,
+		Reason:    string(d.Reason),
+		LatencyMS: d.Latency.Milliseconds(),
+	}
+}
+
+// TraceActor returns the decision's principal in the pkg/trace schema, with
+// its PrincipalType if it parses
+func (d Decision) TraceActor() *trace.Actor {
+	if p, err := ParsePrincipal(d.Principal); err == nil {
+		return p.TraceActor()
+	}
+	return &trace.Actor{Principal: d.Principal}
+}
+
+// TraceError returns the IAM failure behind the decision in the pkg/trace
+// schema, or nil if IAM answered the check
+func (d Decision) TraceError() *trace.AuthzError {
+	switch d.Reason {
+	case ReasonFailOpen, ReasonFailClosed:
+		return &trace.AuthzError{
+			Kind:      "iam_unreachable",
+			Message:   d.Status.Message(),
+			Retryable: true,
+		}
+	case ReasonConfigError, ReasonInvalidPrincipal:
+		return &trace.AuthzError{
+			Kind:    "invalid_request",
+			Message: d.Status.Message(),
+		}
+	default:
+		return nil
+	}
+}
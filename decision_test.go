@@ -0,0 +1,108 @@
+package emulatorauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDecisionTrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision Decision
+		expected trace.Decision
+	}{
+		{
+			name: "granted",
+			decision: Decision{
+				Allowed: true,
+				Reason:  ReasonGranted,
+				Latency: 3 * time.Millisecond,
+			},
+			expected: trace.Decision{Outcome: trace.OutcomeAllow, Reason: "granted", LatencyMS: 3},
+		},
+		{
+			name: "denied",
+			decision: Decision{
+				Allowed: false,
+				Reason:  ReasonDenied,
+			},
+			expected: trace.Decision{Outcome: trace.OutcomeDeny, Reason: "denied"},
+		},
+		{
+			name: "fail open",
+			decision: Decision{
+				Allowed: true,
+				Reason:  ReasonFailOpen,
+				Latency: 2 * time.Second,
+			},
+			expected: trace.Decision{Outcome: trace.OutcomeAllow, Reason: "fail_open", LatencyMS: 2000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.decision.Trace()
+			if *got != tt.expected {
+				t.Errorf("Trace() = %+v, want %+v", *got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecisionTraceError(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision Decision
+		expected *trace.AuthzError
+	}{
+		{
+			name:     "granted has no error",
+			decision: Decision{Allowed: true, Reason: ReasonGranted, Status: status.New(codes.OK, "")},
+			expected: nil,
+		},
+		{
+			name:     "denied has no error",
+			decision: Decision{Reason: ReasonDenied, Status: status.New(codes.OK, "")},
+			expected: nil,
+		},
+		{
+			name:     "fail open is unreachable",
+			decision: Decision{Allowed: true, Reason: ReasonFailOpen, Status: status.New(codes.Unavailable, "connection refused")},
+			expected: &trace.AuthzError{Kind: "iam_unreachable", Message: "connection refused", Retryable: true},
+		},
+		{
+			name:     "fail closed is unreachable",
+			decision: Decision{Reason: ReasonFailClosed, Status: status.New(codes.DeadlineExceeded, "timeout")},
+			expected: &trace.AuthzError{Kind: "iam_unreachable", Message: "timeout", Retryable: true},
+		},
+		{
+			name:     "config error is invalid request",
+			decision: Decision{Reason: ReasonConfigError, Status: status.New(codes.InvalidArgument, "bad resource")},
+			expected: &trace.AuthzError{Kind: "invalid_request", Message: "bad resource"},
+		},
+		{
+			name:     "invalid principal is invalid request",
+			decision: Decision{Reason: ReasonInvalidPrincipal, Status: status.New(codes.InvalidArgument, "invalid principal")},
+			expected: &trace.AuthzError{Kind: "invalid_request", Message: "invalid principal"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.decision.TraceError()
+			if tt.expected == nil {
+				if got != nil {
+					t.Errorf("TraceError() = %+v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.expected {
+				t.Errorf("TraceError() = %+v, want %+v", got, *tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package emulatorauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// ErrorReasonIAMPermissionDenied is the ErrorInfo reason GCP returns when
+	// IAM denies a permission
+	ErrorReasonIAMPermissionDenied = "IAM_PERMISSION_DENIED"
+
+	// ErrorDomainIAM is the ErrorInfo domain for IAM denials
+	ErrorDomainIAM = "iam.googleapis.com"
+)
+
+// PermissionDeniedStatus builds the status GCP returns for an IAM denial: a
+// PermissionDenied status carrying a google.rpc.ErrorInfo with reason
+// IAM_PERMISSION_DENIED and the permission and resource as metadata
+func PermissionDeniedStatus(resource, permission string) *status.Status {
+	st := status.New(codes.PermissionDenied,
+		fmt.Sprintf("Permission '%s' denied for resource '%s' (or it may not exist).", permission, resource))
+
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ErrorReasonIAMPermissionDenied,
+		Domain: ErrorDomainIAM,
+		Metadata: map[string]string{
+			"permission": permission,
+			"resource":   resource,
+		},
+	})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// PermissionDeniedError returns PermissionDeniedStatus as an error, ready to
+// return from a gRPC handler
+func PermissionDeniedError(resource, permission string) error {
+	return PermissionDeniedStatus(resource, permission).Err()
+}
+
+// Err returns nil if the decision allows the request, otherwise the error to
+// reject it with: the Google-compatible PermissionDenied error for an IAM
+// denial, or the decision's own status for any other reason, e.g.
+// Unavailable when IAM was unreachable or Unauthenticated for a check
+// rejected for lack of a principal
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	if d.Reason != ReasonDenied && d.Status.Code() != codes.OK {
+		return d.Status.Err()
+	}
+	return PermissionDeniedError(d.Resource, d.Permission)
+}
+
+// httpError is the Google REST error envelope
+type httpError struct {
+	Error httpErrorBody `json:"error"`
+}
+
+type httpErrorBody struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Status  string            `json:"status"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// HTTPErrorJSON encodes a gRPC status as the Google REST JSON error envelope,
+// including its details (e.g. ErrorInfo) in their "@type" JSON form
+func HTTPErrorJSON(st *status.Status) []byte {
+	body := httpErrorBody{
+		Code:    HTTPStatusFromCode(st.Code()),
+		Message: st.Message(),
+		Status:  code.Code(st.Code()).String(),
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		data, err := protojson.Marshal(detail)
+		if err != nil {
+			continue
+		}
+		body.Details = append(body.Details, data)
+	}
+
+	// Details are valid protojson, so marshaling cannot fail
+	data, _ := json.Marshal(httpError{Error: body})
+	return data
+}
+
+// WriteHTTPError writes a gRPC status as a Google REST JSON error with the
+// matching HTTP status code
+func WriteHTTPError(w http.ResponseWriter, st *status.Status) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(HTTPStatusFromCode(st.Code()))
+	_, _ = w.Write(append(HTTPErrorJSON(st), '\n'))
+}
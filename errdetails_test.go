@@ -0,0 +1,147 @@
+package emulatorauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPermissionDeniedStatus(t *testing.T) {
+	st := PermissionDeniedStatus("projects/p/secrets/s", "secretmanager.secrets.get")
+
+	if st.Code() != codes.PermissionDenied {
+		t.Errorf("Code() = %v, want PermissionDenied", st.Code())
+	}
+	expectedMessage := "Permission 'secretmanager.secrets.get' denied for resource 'projects/p/secrets/s' (or it may not exist)."
+	if st.Message() != expectedMessage {
+		t.Errorf("Message() = %q, want %q", st.Message(), expectedMessage)
+	}
+
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("Details() has %d entries, want 1", len(details))
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok {
+		t.Fatalf("Details()[0] = %T, want *errdetails.ErrorInfo", details[0])
+	}
+	if info.Reason != "IAM_PERMISSION_DENIED" || info.Domain != "iam.googleapis.com" {
+		t.Errorf("ErrorInfo = %v, want IAM_PERMISSION_DENIED from iam.googleapis.com", info)
+	}
+	if info.Metadata["permission"] != "secretmanager.secrets.get" || info.Metadata["resource"] != "projects/p/secrets/s" {
+		t.Errorf("ErrorInfo.Metadata = %v", info.Metadata)
+	}
+}
+
+func TestPermissionDeniedError_RoundTrip(t *testing.T) {
+	// Clients recover the details from the error, as they would from GCP
+	err := PermissionDeniedError("projects/p", "resourcemanager.projects.get")
+
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("FromError(%v) not a status error", err)
+	}
+	if len(st.Details()) != 1 {
+		t.Errorf("round-tripped status lost its details: %v", st.Details())
+	}
+}
+
+func TestDecisionErr(t *testing.T) {
+	allowed := Decision{Allowed: true, Reason: ReasonGranted, Resource: "projects/p", Permission: "p.get"}
+	if err := allowed.Err(); err != nil {
+		t.Errorf("Err() = %v for allowed decision, want nil", err)
+	}
+
+	tests := []struct {
+		reason      DecisionReason
+		status      *status.Status
+		wantCode    codes.Code
+		wantDetails bool
+	}{
+		{ReasonDenied, status.New(codes.OK, ""), codes.PermissionDenied, true},
+		// Errors the ErrorPolicy resolves as denials are IAM denials too
+		{ReasonDenied, status.New(codes.NotFound, "no such resource"), codes.PermissionDenied, true},
+		{ReasonFailClosed, status.New(codes.Unavailable, "connection refused"), codes.Unavailable, false},
+		{ReasonConfigError, status.New(codes.InvalidArgument, "bad resource"), codes.InvalidArgument, false},
+		{ReasonUnauthenticated, status.New(codes.Unauthenticated, "request has no principal"), codes.Unauthenticated, false},
+		// Without a failure status, fall back to a denial rather than no error
+		{ReasonFailClosed, nil, codes.PermissionDenied, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			d := Decision{Reason: tt.reason, Resource: "projects/p", Permission: "p.get", Status: tt.status}
+			st := status.Convert(d.Err())
+			if st.Code() != tt.wantCode || (len(st.Details()) == 1) != tt.wantDetails {
+				t.Errorf("Err() = %v, want %v with ErrorInfo %v", st, tt.wantCode, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorJSON(t *testing.T) {
+	t.Run("without details", func(t *testing.T) {
+		got := string(HTTPErrorJSON(status.New(codes.Unavailable, "IAM emulator unavailable")))
+		expected := `{"error":{"code":503,"message":"IAM emulator unavailable","status":"UNAVAILABLE"}}`
+		if got != expected {
+			t.Errorf("HTTPErrorJSON() = %s, want %s", got, expected)
+		}
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		var envelope struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Status  string `json:"status"`
+				Details []struct {
+					Type     string            `json:"@type"`
+					Reason   string            `json:"reason"`
+					Domain   string            `json:"domain"`
+					Metadata map[string]string `json:"metadata"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+
+		data := HTTPErrorJSON(PermissionDeniedStatus("projects/p/secrets/s", "secretmanager.secrets.get"))
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			t.Fatalf("HTTPErrorJSON() produced invalid JSON %s: %v", data, err)
+		}
+
+		e := envelope.Error
+		if e.Code != 403 || e.Status != "PERMISSION_DENIED" {
+			t.Errorf("error = %d %s, want 403 PERMISSION_DENIED", e.Code, e.Status)
+		}
+		if len(e.Details) != 1 {
+			t.Fatalf("details = %s, want one ErrorInfo", data)
+		}
+		detail := e.Details[0]
+		if detail.Type != "type.googleapis.com/google.rpc.ErrorInfo" {
+			t.Errorf("@type = %q", detail.Type)
+		}
+		if detail.Reason != "IAM_PERMISSION_DENIED" || detail.Domain != "iam.googleapis.com" {
+			t.Errorf("detail = %+v", detail)
+		}
+		if detail.Metadata["permission"] != "secretmanager.secrets.get" || detail.Metadata["resource"] != "projects/p/secrets/s" {
+			t.Errorf("metadata = %v", detail.Metadata)
+		}
+	})
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteHTTPError(rec, status.New(codes.PermissionDenied, "Permission denied"))
+
+	expected := `{"error":{"code":403,"message":"Permission denied","status":"PERMISSION_DENIED"}}` + "\n"
+	if rec.Code != http.StatusForbidden || rec.Body.String() != expected {
+		t.Errorf("WriteHTTPError() = %d %s, want 403 %s", rec.Code, rec.Body, expected)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
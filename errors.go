@@ -1,12 +1,106 @@
 package emulatorauth
 
 import (
+	"errors"
+
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// Sentinel errors for IAM check failures. Errors returned by Client wrap one
+// of these together with the underlying gRPC status error, so callers can use
+// errors.Is for the category and status.Code for the exact gRPC code:
+//
+//	Unavailable, DeadlineExceeded, Canceled → ErrIAMUnavailable (fail-open in permissive mode, fail-closed in strict mode)
+//	PermissionDenied                        → ErrPermissionDenied (deny, both modes)
+//	Unauthenticated                         → ErrUnauthenticated (deny, both modes)
+//	anything else (InvalidArgument, Internal, Unimplemented, NotFound,
+//	ResourceExhausted, ...)                 → ErrInvalidRequest (deny, both modes)
+//
+// A Client with WithErrorPolicy wraps codes remapped to ErrorActionFailMode in
+// ErrIAMUnavailable instead; codes remapped to ErrorActionDeny are not errors.
+var (
+	// ErrIAMUnavailable means the IAM emulator was unreachable, timed out or
+	// the call was cancelled
+	ErrIAMUnavailable = errors.New("IAM emulator unavailable")
+
+	// ErrInvalidRequest means the IAM emulator rejected the check as
+	// malformed or failed internally; it indicates a misconfiguration
+	ErrInvalidRequest = errors.New("invalid IAM request")
+
+	// ErrPermissionDenied means the IAM emulator refused to evaluate the
+	// check for the calling principal
+	ErrPermissionDenied = errors.New("IAM permission denied")
+
+	// ErrUnauthenticated means the IAM emulator could not authenticate the
+	// calling principal
+	ErrUnauthenticated = errors.New("IAM unauthenticated")
+)
+
+// Error is an IAM check failure. It matches its Kind sentinel with errors.Is
+// and keeps the gRPC status of its Cause, so status.Code, IsConnectivityError
+// and IsConfigError still work on it.
+type Error struct {
+	// Kind is one of ErrIAMUnavailable, ErrInvalidRequest,
+	// ErrPermissionDenied or ErrUnauthenticated
+	Kind error
+
+	// Cause is the underlying error from the IAM emulator
+	Cause error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + status.Convert(e.Cause).Message()
+}
+
+// Unwrap exposes both the sentinel and the underlying error to errors.Is/As
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Cause}
+}
+
+// GRPCStatus returns the status of the underlying error
+func (e *Error) GRPCStatus() *status.Status {
+	return status.Convert(e.Cause)
+}
+
+// ClassifyError returns the sentinel for an error from the IAM emulator, or
+// nil for a nil error
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return ErrIAMUnavailable
+	case codes.PermissionDenied:
+		return ErrPermissionDenied
+	case codes.Unauthenticated:
+		return ErrUnauthenticated
+	default:
+		return ErrInvalidRequest
+	}
+}
+
+// wrapError turns an error from the IAM emulator into an *Error
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	return &Error{Kind: ClassifyError(err), Cause: err}
+}
+
 // IsConnectivityError returns true if the error is due to connectivity issues
-// (IAM emulator unreachable, timeout, or cancelled context)
+// (IAM emulator unreachable, timeout, or cancelled context).
+// It only looks at the gRPC code, so it matches errors.Is(err,
+// ErrIAMUnavailable) only under DefaultErrorPolicy; prefer errors.Is, which
+// also covers codes WithErrorPolicy remaps to ErrorActionFailMode.
 func IsConnectivityError(err error) bool {
 	if err == nil {
 		return false
@@ -19,7 +113,10 @@ func IsConnectivityError(err error) bool {
 }
 
 // IsConfigError returns true if the error indicates a configuration problem
-// that should always deny (in both permissive and strict modes)
+// that should always deny (in both permissive and strict modes).
+// It only covers InvalidArgument, Internal and Unimplemented; prefer
+// errors.Is(err, ErrInvalidRequest), which covers every non-connectivity code
+// without a more specific sentinel.
 func IsConfigError(err error) bool {
 	if err == nil {
 		return false
@@ -194,3 +194,79 @@ func TestErrorClassification_MutuallyExclusive(t *testing.T) {
 		}
 	}
 }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"nil error", nil, nil},
+		{"Unavailable", status.Error(codes.Unavailable, "down"), ErrIAMUnavailable},
+		{"DeadlineExceeded", status.Error(codes.DeadlineExceeded, "timeout"), ErrIAMUnavailable},
+		{"Canceled", status.Error(codes.Canceled, "canceled"), ErrIAMUnavailable},
+		{"PermissionDenied", status.Error(codes.PermissionDenied, "denied"), ErrPermissionDenied},
+		{"Unauthenticated", status.Error(codes.Unauthenticated, "who"), ErrUnauthenticated},
+		{"InvalidArgument", status.Error(codes.InvalidArgument, "bad"), ErrInvalidRequest},
+		{"Internal", status.Error(codes.Internal, "boom"), ErrInvalidRequest},
+		{"Unimplemented", status.Error(codes.Unimplemented, "nope"), ErrInvalidRequest},
+		{"NotFound", status.Error(codes.NotFound, "missing"), ErrInvalidRequest},
+		{"ResourceExhausted", status.Error(codes.ResourceExhausted, "quota"), ErrInvalidRequest},
+		{"non-gRPC error", errors.New("generic error"), ErrInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyError(tt.err)
+			if got != tt.expected {
+				t.Errorf("ClassifyError(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestError_Wrapping(t *testing.T) {
+	cause := status.Error(codes.Unavailable, "connection refused")
+	err := wrapError(cause)
+
+	if !errors.Is(err, ErrIAMUnavailable) {
+		t.Error("errors.Is(err, ErrIAMUnavailable) = false, want true")
+	}
+	if errors.Is(err, ErrInvalidRequest) {
+		t.Error("errors.Is(err, ErrInvalidRequest) = true, want false")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is(err, cause) = false, want true")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatal("errors.As(err, *Error) = false, want true")
+	}
+	if e.Kind != ErrIAMUnavailable {
+		t.Errorf("Kind = %v, want %v", e.Kind, ErrIAMUnavailable)
+	}
+
+	// The gRPC status survives wrapping
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("status.Code(err) = %v, want %v", got, codes.Unavailable)
+	}
+	if got := status.Convert(err).Message(); got != "connection refused" {
+		t.Errorf("status message = %q, want %q", got, "connection refused")
+	}
+	if !IsConnectivityError(err) {
+		t.Error("IsConnectivityError(err) = false, want true")
+	}
+
+	if got, want := err.Error(), "IAM emulator unavailable: connection refused"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	// Wrapping is idempotent
+	if again := wrapError(err); again != err {
+		t.Errorf("wrapError(wrapped) = %v, want the same error", again)
+	}
+	if wrapError(nil) != nil {
+		t.Error("wrapError(nil) != nil")
+	}
+}
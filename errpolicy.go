@@ -0,0 +1,158 @@
+package emulatorauth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorAction is how a check resolves when the IAM emulator returns an error
+type ErrorAction string
+
+const (
+	// ErrorActionDeny treats the error as a plain denial: the check is denied
+	// with ReasonDenied and no error is returned
+	ErrorActionDeny ErrorAction = "deny"
+
+	// ErrorActionFailMode treats the error like an unreachable IAM emulator:
+	// allowed in permissive mode (fail-open), denied with an error in strict
+	// mode (fail-closed). These errors are also retried and count towards the
+	// circuit breaker.
+	ErrorActionFailMode ErrorAction = "fail_mode"
+
+	// ErrorActionError treats the error as a misconfiguration: the check is
+	// denied and the error returned, in both modes
+	ErrorActionError ErrorAction = "error"
+)
+
+// ErrorPolicy maps gRPC codes returned by the IAM emulator to the action
+// taken. Codes without an entry use DefaultErrorPolicy.
+type ErrorPolicy map[codes.Code]ErrorAction
+
+// DefaultErrorPolicy returns the built-in classification: Unavailable,
+// DeadlineExceeded and Canceled follow the mode (as IsConnectivityError),
+// every other code is an error
+func DefaultErrorPolicy() ErrorPolicy {
+	return ErrorPolicy{
+		codes.Unavailable:      ErrorActionFailMode,
+		codes.DeadlineExceeded: ErrorActionFailMode,
+		codes.Canceled:         ErrorActionFailMode,
+	}
+}
+
+// WithErrorPolicy overrides how errors from the IAM emulator are resolved.
+// Entries are merged over DefaultErrorPolicy, e.g.
+//
+//	WithErrorPolicy(ErrorPolicy{
+//		codes.ResourceExhausted: ErrorActionFailMode,
+//		codes.NotFound:          ErrorActionDeny,
+//	})
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(o *clientOptions) {
+		if o.errorPolicy == nil {
+			o.errorPolicy = DefaultErrorPolicy()
+		}
+		for code, action := range policy {
+			o.errorPolicy[code] = action
+		}
+	}
+}
+
+// Action returns the action for a gRPC code
+func (p ErrorPolicy) Action(code codes.Code) ErrorAction {
+	if action, ok := p[code]; ok {
+		return action
+	}
+	if action, ok := DefaultErrorPolicy()[code]; ok {
+		return action
+	}
+	return ErrorActionError
+}
+
+// ParseErrorPolicy parses a comma-separated list of CODE=action entries, e.g.
+// "RESOURCE_EXHAUSTED=fail_mode,NOT_FOUND=deny". Codes use their canonical
+// upper-case names and both are case-insensitive.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	policy := ErrorPolicy{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("error policy entry %q is not CODE=action", entry)
+		}
+
+		code, err := parseCode(name)
+		if err != nil {
+			return nil, err
+		}
+		policy[code] = parseErrorAction(action)
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// parseCode parses a canonical gRPC code name such as "NOT_FOUND"
+// (case-insensitive)
+func parseCode(name string) (codes.Code, error) {
+	var code codes.Code
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return 0, fmt.Errorf("unknown gRPC code %q in error policy", name)
+	}
+	return code, nil
+}
+
+func parseErrorAction(s string) ErrorAction {
+	return ErrorAction(strings.ToLower(strings.TrimSpace(s)))
+}
+
+func (p ErrorPolicy) validate() error {
+	for code, action := range p {
+		if code == codes.OK {
+			return errors.New("error policy cannot map OK")
+		}
+		switch action {
+		case ErrorActionDeny, ErrorActionFailMode, ErrorActionError:
+		default:
+			return fmt.Errorf("unknown error action %q for %s", action, code)
+		}
+	}
+	return nil
+}
+
+// transient reports whether err resolves to the mode's fail-open/fail-closed
+// decision, which also makes it retryable and a circuit breaker failure
+func (p ErrorPolicy) transient(err error) bool {
+	return err != nil && p.Action(status.Code(err)) == ErrorActionFailMode
+}
+
+// wrapActionError turns an error from the IAM emulator into an *Error whose
+// Kind matches the action it was resolved with: ErrIAMUnavailable for the fail
+// mode, the ClassifyError sentinel otherwise
+func wrapActionError(err error, action ErrorAction) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := ClassifyError(err)
+	switch {
+	case action == ErrorActionFailMode:
+		kind = ErrIAMUnavailable
+	case kind == ErrIAMUnavailable:
+		// A connectivity code remapped away from the fail mode
+		kind = ErrInvalidRequest
+	}
+
+	return &Error{Kind: kind, Cause: err}
+}
@@ -0,0 +1,190 @@
+package emulatorauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorPolicyAction(t *testing.T) {
+	policy := ErrorPolicy{
+		codes.ResourceExhausted: ErrorActionFailMode,
+		codes.NotFound:          ErrorActionDeny,
+		codes.Canceled:          ErrorActionError,
+	}
+
+	tests := []struct {
+		code codes.Code
+		want ErrorAction
+	}{
+		{codes.ResourceExhausted, ErrorActionFailMode},
+		{codes.NotFound, ErrorActionDeny},
+		{codes.Canceled, ErrorActionError},
+		{codes.Unavailable, ErrorActionFailMode},      // default
+		{codes.DeadlineExceeded, ErrorActionFailMode}, // default
+		{codes.InvalidArgument, ErrorActionError},     // default
+		{codes.PermissionDenied, ErrorActionError},    // default
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := policy.Action(tt.code); got != tt.want {
+				t.Errorf("Action(%v) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+
+	// A nil policy is the default table
+	var none ErrorPolicy
+	for code, want := range DefaultErrorPolicy() {
+		if got := none.Action(code); got != want {
+			t.Errorf("nil Action(%v) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ErrorPolicy
+		wantErr bool
+	}{
+		{"empty", "", ErrorPolicy{}, false},
+		{
+			name:  "several entries",
+			input: "RESOURCE_EXHAUSTED=fail_mode, not_found=DENY",
+			want: ErrorPolicy{
+				codes.ResourceExhausted: ErrorActionFailMode,
+				codes.NotFound:          ErrorActionDeny,
+			},
+		},
+		{"unknown code", "NOT_A_CODE=deny", nil, true},
+		{"unknown action", "NOT_FOUND=allow", nil, true},
+		{"missing action", "NOT_FOUND", nil, true},
+		{"OK cannot be mapped", "OK=deny", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseErrorPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseErrorPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseErrorPolicy(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			for code, action := range tt.want {
+				if got[code] != action {
+					t.Errorf("ParseErrorPolicy(%q)[%v] = %v, want %v", tt.input, code, got[code], action)
+				}
+			}
+		})
+	}
+}
+
+func TestWithErrorPolicy_Invalid(t *testing.T) {
+	_, err := NewClient("localhost:9999", AuthModeStrict, WithErrorPolicy(ErrorPolicy{codes.NotFound: "allow"}))
+	if err == nil {
+		t.Error("NewClient() should reject an unknown error action")
+	}
+}
+
+func TestClient_ErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        AuthMode
+		code        codes.Code
+		wantAllowed bool
+		wantReason  DecisionReason
+		wantKind    error
+	}{
+		{"remapped to fail mode permissive", AuthModePermissive, codes.ResourceExhausted, true, ReasonFailOpen, nil},
+		{"remapped to fail mode strict", AuthModeStrict, codes.ResourceExhausted, false, ReasonFailClosed, ErrIAMUnavailable},
+		{"remapped to deny permissive", AuthModePermissive, codes.NotFound, false, ReasonDenied, nil},
+		{"remapped to deny strict", AuthModeStrict, codes.NotFound, false, ReasonDenied, nil},
+		{"connectivity remapped to error", AuthModePermissive, codes.Unavailable, false, ReasonConfigError, ErrInvalidRequest},
+		{"default still applies", AuthModeStrict, codes.InvalidArgument, false, ReasonConfigError, ErrInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, addr := startFakeIAMServer(t)
+			fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+				return nil, status.Error(tt.code, "rejected")
+			})
+
+			client, err := NewClient(addr, tt.mode, WithErrorPolicy(ErrorPolicy{
+				codes.ResourceExhausted: ErrorActionFailMode,
+				codes.NotFound:          ErrorActionDeny,
+				codes.Unavailable:       ErrorActionError,
+			}))
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			d, err := client.Decide(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+			if d.Allowed != tt.wantAllowed || d.Reason != tt.wantReason {
+				t.Errorf("Decide() = %v/%v, want %v/%v", d.Allowed, d.Reason, tt.wantAllowed, tt.wantReason)
+			}
+			if tt.wantKind == nil {
+				if err != nil {
+					t.Errorf("Decide() error = %v, want nil", err)
+				}
+			} else if !errors.Is(err, tt.wantKind) {
+				t.Errorf("Decide() error = %v, want %v", err, tt.wantKind)
+			}
+			if d.Status.Code() != tt.code {
+				t.Errorf("Decision.Status code = %v, want %v", d.Status.Code(), tt.code)
+			}
+		})
+	}
+}
+
+func TestClient_ErrorPolicyRetriesFailMode(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.ResourceExhausted, "quota")
+	})
+
+	client, err := NewClient(addr, AuthModePermissive,
+		WithRetry(fastRetry(3)),
+		WithErrorPolicy(ErrorPolicy{codes.ResourceExhausted: ErrorActionFailMode}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	d, _ := client.Decide(context.Background(), "user:test@example.com", "projects/test-project", "secretmanager.secrets.get")
+	if d.Attempts != 3 || fake.Calls() != 3 {
+		t.Errorf("attempts = %d, calls = %d, want 3 each", d.Attempts, fake.Calls())
+	}
+}
+
+func TestNewClientFromConfig_ErrorPolicy(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.NotFound, "no such resource")
+	})
+
+	client, err := NewClientFromConfig(Config{
+		Mode:        AuthModeStrict,
+		Host:        addr,
+		ErrorPolicy: ErrorPolicy{codes.NotFound: ErrorActionDeny},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	allowed, err := client.CheckPermission(context.Background(), "user:test@example.com", "projects/missing", "secretmanager.secrets.get")
+	if allowed || err != nil {
+		t.Errorf("CheckPermission() = %v, %v, want plain deny", allowed, err)
+	}
+}
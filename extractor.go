@@ -0,0 +1,186 @@
+package emulatorauth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// PrincipalExtractor finds the caller's principal in an incoming request.
+// Both methods return "" when the source holds no principal; sources that
+// only exist for one transport always return "" for the other.
+type PrincipalExtractor interface {
+	// ExtractFromContext extracts the principal of a gRPC request
+	ExtractFromContext(ctx context.Context) string
+
+	// ExtractFromRequest extracts the principal of an HTTP request
+	ExtractFromRequest(r *http.Request) string
+}
+
+// WithPrincipalExtractor sets where the interceptors and middleware read the
+// principal from (DefaultPrincipalExtractor by default)
+func WithPrincipalExtractor(extractor PrincipalExtractor) EnforceOption {
+	return func(e *enforcer) {
+		e.principals = extractor
+	}
+}
+
+// DefaultPrincipalExtractor reads X-Emulator-Principal, falling back to a
+// JWT bearer token. It is used by ExtractPrincipalFromContext and
+// ExtractPrincipalFromRequest.
+func DefaultPrincipalExtractor() PrincipalExtractor {
+	return defaultPrincipalExtractor
+}
+
+var defaultPrincipalExtractor = ChainPrincipalExtractors(PrincipalHeader(), PrincipalBearerToken())
+
+// ChainPrincipalExtractors tries each extractor in order and returns the
+// first principal found
+func ChainPrincipalExtractors(extractors ...PrincipalExtractor) PrincipalExtractor {
+	return principalChain(extractors)
+}
+
+type principalChain []PrincipalExtractor
+
+func (c principalChain) ExtractFromContext(ctx context.Context) string {
+	for _, extractor := range c {
+		if principal := extractor.ExtractFromContext(ctx); principal != "" {
+			return principal
+		}
+	}
+	return ""
+}
+
+func (c principalChain) ExtractFromRequest(r *http.Request) string {
+	for _, extractor := range c {
+		if principal := extractor.ExtractFromRequest(r); principal != "" {
+			return principal
+		}
+	}
+	return ""
+}
+
+// PrincipalHeader reads the emulator's x-emulator-principal metadata or
+// X-Emulator-Principal header
+func PrincipalHeader() PrincipalExtractor {
+	return headerExtractor{}
+}
+
+type headerExtractor struct{}
+
+func (headerExtractor) ExtractFromContext(ctx context.Context) string {
+	return firstIncomingMetadata(ctx, PrincipalMetadataKey)
+}
+
+func (headerExtractor) ExtractFromRequest(r *http.Request) string {
+	return r.Header.Get(PrincipalHeaderKey)
+}
+
+// PrincipalBearerToken reads the email claim of a JWT bearer token in the
+// authorization metadata or Authorization header (see PrincipalFromJWT)
+func PrincipalBearerToken() PrincipalExtractor {
+	return bearerTokenExtractor{}
+}
+
+type bearerTokenExtractor struct{}
+
+func (bearerTokenExtractor) ExtractFromContext(ctx context.Context) string {
+	return principalFromAuthorization(firstIncomingMetadata(ctx, AuthorizationMetadataKey))
+}
+
+func (bearerTokenExtractor) ExtractFromRequest(r *http.Request) string {
+	return principalFromAuthorization(r.Header.Get(AuthorizationHeaderKey))
+}
+
+// PrincipalClientCert reads the mTLS client certificate: its first email SAN
+// maps to a user: or serviceAccount: principal like a JWT email claim, and
+// a principal:// URI SAN is used as is. The certificate is not verified
+// here; configure the server to require and verify client certificates.
+func PrincipalClientCert() PrincipalExtractor {
+	return clientCertExtractor{}
+}
+
+type clientCertExtractor struct{}
+
+func (clientCertExtractor) ExtractFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return ""
+	}
+	return principalFromCert(info.State.PeerCertificates[0])
+}
+
+func (clientCertExtractor) ExtractFromRequest(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return principalFromCert(r.TLS.PeerCertificates[0])
+}
+
+func principalFromCert(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return principalFromEmail(cert.EmailAddresses[0])
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "principal" {
+			return uri.String()
+		}
+	}
+	return ""
+}
+
+// StaticPrincipal always returns principal, e.g. as the last link of a
+// chain to give unauthenticated requests a default identity
+func StaticPrincipal(principal string) PrincipalExtractor {
+	return staticExtractor(principal)
+}
+
+type staticExtractor string
+
+func (s staticExtractor) ExtractFromContext(context.Context) string {
+	return string(s)
+}
+
+func (s staticExtractor) ExtractFromRequest(*http.Request) string {
+	return string(s)
+}
+
+// PrincipalQueryParam reads the principal from a URL query parameter, e.g.
+// PrincipalQueryParam("principal") for ?principal=user:alice@example.com
+// when testing from a browser. It only applies to HTTP requests.
+func PrincipalQueryParam(name string) PrincipalExtractor {
+	return queryParamExtractor(name)
+}
+
+type queryParamExtractor string
+
+func (queryParamExtractor) ExtractFromContext(context.Context) string {
+	return ""
+}
+
+func (q queryParamExtractor) ExtractFromRequest(r *http.Request) string {
+	return r.URL.Query().Get(string(q))
+}
+
+// firstIncomingMetadata returns the first value of key in the incoming gRPC
+// metadata, or ""
+func firstIncomingMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,122 @@
+package emulatorauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestPrincipalClientCert(t *testing.T) {
+	workload, _ := url.Parse("principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/subject/runner")
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{
+			name: "user email SAN",
+			cert: &x509.Certificate{EmailAddresses: []string{"alice@example.com"}},
+			want: "user:alice@example.com",
+		},
+		{
+			name: "service account email SAN",
+			cert: &x509.Certificate{EmailAddresses: []string{"app@test-project.iam.gserviceaccount.com"}},
+			want: "serviceAccount:app@test-project.iam.gserviceaccount.com",
+		},
+		{
+			name: "workload identity URI SAN",
+			cert: &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org"}, workload}},
+			want: workload.String(),
+		},
+		{
+			name: "no usable SAN",
+			cert: &x509.Certificate{DNSNames: []string{"client.example.com"}},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+
+			ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+			if got := PrincipalClientCert().ExtractFromContext(ctx); got != tt.want {
+				t.Errorf("ExtractFromContext() = %q, want %q", got, tt.want)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &state
+			if got := PrincipalClientCert().ExtractFromRequest(req); got != tt.want {
+				t.Errorf("ExtractFromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Plaintext connections have no certificate
+	if got := PrincipalClientCert().ExtractFromContext(context.Background()); got != "" {
+		t.Errorf("ExtractFromContext() without peer = %q, want empty", got)
+	}
+	if got := PrincipalClientCert().ExtractFromRequest(httptest.NewRequest(http.MethodGet, "/", nil)); got != "" {
+		t.Errorf("ExtractFromRequest() without TLS = %q, want empty", got)
+	}
+}
+
+func TestChainPrincipalExtractors(t *testing.T) {
+	token := makeJWT(t, map[string]any{"email": "carol@example.com"}, "")
+	chain := ChainPrincipalExtractors(
+		PrincipalQueryParam("principal"),
+		PrincipalHeader(),
+		PrincipalBearerToken(),
+		StaticPrincipal("user:default@example.com"),
+	)
+
+	tests := []struct {
+		name          string
+		query         string
+		header        string
+		authorization string
+		want          string
+	}{
+		{name: "query param first", query: "user:alice@example.com", header: "user:bob@example.com", want: "user:alice@example.com"},
+		{name: "header", header: "user:bob@example.com", authorization: "Bearer " + token, want: "user:bob@example.com"},
+		{name: "bearer token", authorization: "Bearer " + token, want: "user:carol@example.com"},
+		{name: "static default", want: "user:default@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?principal="+url.QueryEscape(tt.query), nil)
+			md := metadata.MD{}
+			if tt.header != "" {
+				req.Header.Set(PrincipalHeaderKey, tt.header)
+				md.Set(PrincipalMetadataKey, tt.header)
+			}
+			if tt.authorization != "" {
+				req.Header.Set(AuthorizationHeaderKey, tt.authorization)
+				md.Set(AuthorizationMetadataKey, tt.authorization)
+			}
+
+			if got := chain.ExtractFromRequest(req); got != tt.want {
+				t.Errorf("ExtractFromRequest() = %q, want %q", got, tt.want)
+			}
+
+			// Query params don't exist for gRPC
+			wantContext := tt.want
+			if tt.query != "" {
+				wantContext = tt.header
+			}
+			if got := chain.ExtractFromContext(metadata.NewIncomingContext(context.Background(), md)); got != wantContext {
+				t.Errorf("ExtractFromContext() = %q, want %q", got, wantContext)
+			}
+		})
+	}
+}
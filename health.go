@@ -0,0 +1,90 @@
+package emulatorauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// readyPollInterval is how often WaitReady re-checks the IAM emulator
+const readyPollInterval = 100 * time.Millisecond
+
+// Ping checks that the IAM emulator is reachable and serving. It calls the
+// standard grpc.health.v1 service; an emulator that doesn't implement it
+// still counts as reachable since it answered.
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout())
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		return wrapError(err)
+	}
+
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return wrapError(status.Errorf(codes.Unavailable, "IAM emulator health status is %s", resp.GetStatus()))
+	}
+
+	return nil
+}
+
+// WaitReady blocks until Ping succeeds or the context is done, e.g. to hold
+// back a service emulator's own readiness while IAM starts. Errors that are
+// not connectivity errors are returned immediately.
+func (c *Client) WaitReady(ctx context.Context) error {
+	for {
+		err := c.Ping(ctx)
+		if err == nil || !IsConnectivityError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// healthResponse is the JSON body written by HealthHandler
+type healthResponse struct {
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthHandler returns an http.Handler reporting IAM connectivity for
+// Kubernetes or docker-compose health checks. It responds 503 when IAM is
+// unreachable in strict mode, since every check would fail closed; in other
+// modes it responds 200 and reports the connectivity in the body.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := c.Mode()
+		resp := healthResponse{
+			Status: "ok",
+			Mode:   mode.String(),
+		}
+		code := http.StatusOK
+
+		if err := c.Ping(r.Context()); err != nil {
+			resp.Status = "unreachable"
+			resp.Error = err.Error()
+			if mode == AuthModeStrict {
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,211 @@
+package emulatorauth
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// startHealthServer starts an IAM server that also exposes grpc.health.v1
+func startHealthServer(t *testing.T, lis net.Listener) *health.Server {
+	t.Helper()
+
+	healthServer := health.NewServer()
+	server := grpc.NewServer()
+	iampb.RegisterIAMPolicyServer(server, &fakeIAMServer{})
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return healthServer
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return lis
+}
+
+func TestPing(t *testing.T) {
+	t.Run("health service serving", func(t *testing.T) {
+		lis := listen(t)
+		startHealthServer(t, lis)
+
+		client, err := NewClient(lis.Addr().String(), AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		if err := client.Ping(context.Background()); err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	})
+
+	t.Run("health service not serving", func(t *testing.T) {
+		lis := listen(t)
+		healthServer := startHealthServer(t, lis)
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+		client, err := NewClient(lis.Addr().String(), AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		err = client.Ping(context.Background())
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Ping() error = %v, want Unavailable", err)
+		}
+	})
+
+	t.Run("no health service", func(t *testing.T) {
+		// The IAM emulator answered, so it is reachable
+		_, addr := startFakeIAMServer(t)
+
+		client, err := NewClient(addr, AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		if err := client.Ping(context.Background()); err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		client, err := NewClient("localhost:9999", AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		if err := client.Ping(context.Background()); !IsConnectivityError(err) {
+			t.Errorf("Ping() error = %v, want connectivity error", err)
+		}
+	})
+
+	t.Run("IAM emulator", func(t *testing.T) {
+		client, err := NewClient(iamEmulatorHost, AuthModeStrict)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		if err := client.Ping(context.Background()); err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	})
+}
+
+func TestWaitReady(t *testing.T) {
+	// Reserve an address, then start serving on it only after a delay
+	lis := listen(t)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	client, err := NewClient(addr, AuthModeStrict, WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		startHealthServer(t, lis)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.WaitReady(ctx); err != nil {
+		t.Errorf("WaitReady() error = %v", err)
+	}
+}
+
+func TestWaitReady_ContextDone(t *testing.T) {
+	client, err := NewClient("localhost:9999", AuthModeStrict)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err = client.WaitReady(ctx)
+	if err == nil {
+		t.Fatal("WaitReady() should fail when IAM never becomes reachable")
+	}
+	if ctx.Err() == nil {
+		t.Error("WaitReady() returned before the context was done")
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		mode       AuthMode
+		wantCode   int
+		wantStatus string
+	}{
+		{"reachable strict", iamEmulatorHost, AuthModeStrict, http.StatusOK, "ok"},
+		{"unreachable strict", "localhost:9999", AuthModeStrict, http.StatusServiceUnavailable, "unreachable"},
+		{"unreachable permissive", "localhost:9999", AuthModePermissive, http.StatusOK, "unreachable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.host, tt.mode)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			rec := httptest.NewRecorder()
+			client.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+
+			var body healthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if body.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", body.Status, tt.wantStatus)
+			}
+			if body.Mode != string(tt.mode) {
+				t.Errorf("mode = %q, want %q", body.Mode, tt.mode)
+			}
+			if (body.Error != "") != (tt.wantStatus != "ok") {
+				t.Errorf("error = %q inconsistent with status %q", body.Error, body.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package emulatorauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ResourceFunc extracts the IAM resource name from a gRPC request message
+type ResourceFunc func(ctx context.Context, req any) (string, error)
+
+// MethodRule is the permission a gRPC method requires and how to find the
+// resource it applies to
+type MethodRule struct {
+	Permission string
+	Resource   ResourceFunc
+}
+
+// MethodRules maps full gRPC method names
+// (e.g. "/google.cloud.secretmanager.v1.SecretManagerService/GetSecret")
+// to the rule enforced for them
+type MethodRules map[string]MethodRule
+
+// UnmappedPolicy defines how requests without a rule are handled
+type UnmappedPolicy string
+
+const (
+	// UnmappedDeny rejects requests without a rule as permission denied (default)
+	UnmappedDeny UnmappedPolicy = "deny"
+
+	// UnmappedAllow lets requests without a rule through unchecked
+	UnmappedAllow UnmappedPolicy = "allow"
+
+	// UnmappedError rejects requests without a rule as an internal error,
+	// surfacing the missing rule as a bug in the emulator
+	UnmappedError UnmappedPolicy = "error"
+)
+
+// EnforceOption configures the enforcement interceptors
+type EnforceOption func(*enforcer)
+
+// WithUnmappedPolicy sets how requests without a rule are handled
+// (UnmappedDeny by default)
+func WithUnmappedPolicy(policy UnmappedPolicy) EnforceOption {
+	return func(e *enforcer) {
+		e.unmapped = policy
+	}
+}
+
+// enforcer holds the shared enforcement settings
+type enforcer struct {
+	client     *Client
+	unmapped   UnmappedPolicy
+	principals PrincipalExtractor
+}
+
+func newEnforcer(client *Client, opts []EnforceOption) *enforcer {
+	e := &enforcer{
+		client:     client,
+		unmapped:   UnmappedDeny,
+		principals: defaultPrincipalExtractor,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// enabled reports whether requests are checked at all: a nil client or one in
+// AuthModeOff lets everything through, even requests without a rule
+func (e *enforcer) enabled() bool {
+	return e.client != nil && e.client.Mode().IsEnabled()
+}
+
+// authorizeUnmapped applies the unmapped policy to a request without a rule
+func (e *enforcer) authorizeUnmapped(name string) error {
+	switch e.unmapped {
+	case UnmappedAllow:
+		return nil
+	case UnmappedError:
+		return status.Errorf(codes.Internal, "no IAM rule configured for %s", name)
+	default:
+		return status.Errorf(codes.PermissionDenied, "no IAM rule configured for %s", name)
+	}
+}
+
+// authorize checks the principal's permission on the resource, returning a
+// gRPC status error if the request must be rejected. Allowed requests get a
+// context carrying the principal and decision.
+func (e *enforcer) authorize(ctx context.Context, principal, resource, permission string) (context.Context, error) {
+	decision, err := e.client.Decide(ctx, principal, resource, permission)
+	switch {
+	case err == nil:
+	case decision.Reason == ReasonInvalidPrincipal:
+		// The caller's mistake, not the emulator's: InvalidArgument, not Internal
+		return ctx, decision.Err()
+	case errors.Is(err, ErrIAMUnavailable):
+		return ctx, status.Error(codes.Unavailable, "IAM emulator unavailable")
+	case errors.Is(err, ErrPermissionDenied):
+		return ctx, status.Errorf(codes.PermissionDenied, "IAM check rejected: %v", status.Convert(err).Message())
+	case errors.Is(err, ErrUnauthenticated):
+		return ctx, status.Errorf(codes.Unauthenticated, "IAM check rejected: %v", status.Convert(err).Message())
+	default:
+		return ctx, status.Errorf(codes.Internal, "IAM check failed: %v", status.Convert(err).Message())
+	}
+
+	if err := decision.Err(); err != nil {
+		return ctx, err
+	}
+
+	// The decision has the principal actually checked, e.g. a default one
+	if p, err := ParsePrincipal(decision.Principal); err == nil {
+		ctx = WithPrincipal(ctx, p)
+	}
+	return WithDecision(ctx, decision), nil
+}
+
+// grpcEnforcer enforces MethodRules in gRPC interceptors
+type grpcEnforcer struct {
+	*enforcer
+	methodRules MethodRules
+}
+
+// authorizeMethod enforces the rule for a gRPC method against its request
+func (e *grpcEnforcer) authorizeMethod(ctx context.Context, method string, req any) (context.Context, error) {
+	rule, ok := e.methodRules[method]
+	if !ok {
+		return ctx, e.authorizeUnmapped(method)
+	}
+
+	if rule.Resource == nil {
+		return ctx, status.Errorf(codes.Internal, "IAM rule for %s has no resource extractor", method)
+	}
+	resource, err := rule.Resource(ctx, req)
+	if err != nil {
+		return ctx, status.Errorf(codes.InvalidArgument, "cannot determine IAM resource: %v", err)
+	}
+
+	return e.authorize(ctx, e.principals.ExtractFromContext(ctx), resource, rule.Permission)
+}
+
+// UnaryServerInterceptor enforces IAM on unary RPCs. The principal comes from
+// WithPrincipalExtractor (ExtractPrincipalFromContext by default) and the
+// resource from the method's rule. Handlers of checked calls can read both
+// back with PrincipalFromContext and DecisionFromContext. A nil client or one
+// in AuthModeOff disables enforcement, matching the usual "IAM off" setup.
+func UnaryServerInterceptor(client *Client, rules MethodRules, opts ...EnforceOption) grpc.UnaryServerInterceptor {
+	e := &grpcEnforcer{enforcer: newEnforcer(client, opts), methodRules: rules}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !e.enabled() {
+			return handler(ctx, req)
+		}
+		ctx, err := e.authorizeMethod(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor enforces IAM on streaming RPCs. The check runs when
+// the handler receives the first request message, so the resource can be read
+// from it; nothing is sent or received past a denied check. From then on the
+// stream's Context carries the principal and decision. A nil client or one in
+// AuthModeOff disables enforcement.
+func StreamServerInterceptor(client *Client, rules MethodRules, opts ...EnforceOption) grpc.StreamServerInterceptor {
+	e := &grpcEnforcer{enforcer: newEnforcer(client, opts), methodRules: rules}
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !e.enabled() {
+			return handler(srv, ss)
+		}
+		if _, ok := e.methodRules[info.FullMethod]; !ok {
+			if err := e.authorizeUnmapped(info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, enforcer: e, method: info.FullMethod})
+	}
+}
+
+// authorizedStream runs the IAM check on the first message received (or
+// before the first message sent, for handlers that send first)
+type authorizedStream struct {
+	grpc.ServerStream
+
+	enforcer *grpcEnforcer
+	method   string
+
+	mu   sync.Mutex
+	done bool
+	err  error
+	ctx  context.Context // set once the check passes
+}
+
+func (s *authorizedStream) check(req any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.done {
+		ctx, err := s.enforcer.authorizeMethod(s.ServerStream.Context(), s.method, req)
+		if err == nil {
+			s.ctx = ctx
+		}
+		s.err = err
+		s.done = true
+	}
+	return s.err
+}
+
+func (s *authorizedStream) Context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return s.ServerStream.Context()
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	s.mu.Lock()
+	done, err := s.done, s.err
+	s.mu.Unlock()
+	if done {
+		if err != nil {
+			return err
+		}
+		return s.ServerStream.RecvMsg(m)
+	}
+
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.check(m)
+}
+
+func (s *authorizedStream) SendMsg(m any) error {
+	if err := s.check(nil); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// StaticResource returns a ResourceFunc that always yields the same resource
+func StaticResource(resource string) ResourceFunc {
+	return func(context.Context, any) (string, error) {
+		return resource, nil
+	}
+}
+
+// ResourceField returns a ResourceFunc that reads a string field from a
+// protobuf request, e.g. "name" or "parent". Nested fields use dots
+// ("secret.name").
+func ResourceField(path string) ResourceFunc {
+	fields := strings.Split(path, ".")
+
+	return func(_ context.Context, req any) (string, error) {
+		msg, ok := req.(proto.Message)
+		if !ok || msg == nil {
+			return "", fmt.Errorf("request %T is not a protobuf message", req)
+		}
+
+		m := msg.ProtoReflect()
+		for i, name := range fields {
+			fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+			if fd == nil {
+				return "", fmt.Errorf("%s has no field %q", m.Descriptor().FullName(), name)
+			}
+
+			last := i == len(fields)-1
+			switch {
+			case last && fd.Kind() == protoreflect.StringKind && !fd.IsList():
+				value := m.Get(fd).String()
+				if value == "" {
+					return "", fmt.Errorf("field %q is empty", path)
+				}
+				return value, nil
+			case !last && fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap():
+				m = m.Get(fd).Message()
+			default:
+				return "", fmt.Errorf("field %q is not a string", path)
+			}
+		}
+
+		return "", errors.New("empty resource field path")
+	}
+}
@@ -0,0 +1,444 @@
+package emulatorauth
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/google.iam.v1.IAMPolicy/GetIamPolicy"
+
+// startAliceOnlyIAMServer starts a fake IAM server that grants every
+// permission to user:alice@example.com and nothing to anyone else
+func startAliceOnlyIAMServer(t *testing.T) (*fakeIAMServer, string) {
+	t.Helper()
+
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		if ExtractPrincipalFromContext(ctx) != "user:alice@example.com" {
+			return &iampb.TestIamPermissionsResponse{}, nil
+		}
+		return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+	})
+	return fake, addr
+}
+
+func newTestClient(t *testing.T, addr string, mode AuthMode, opts ...Option) *Client {
+	t.Helper()
+
+	client, err := NewClient(addr, mode, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func incomingPrincipal(principal string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(PrincipalMetadataKey, principal))
+}
+
+var testRules = MethodRules{
+	testMethod: {
+		Permission: "resourcemanager.projects.getIamPolicy",
+		Resource:   ResourceField("resource"),
+	},
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+	offClient := newTestClient(t, addr, AuthModeOff)
+	auditClient := newTestClient(t, addr, AuthModeAudit)
+
+	tests := []struct {
+		name      string
+		client    *Client
+		method    string
+		principal string
+		req       any
+		opts      []EnforceOption
+		wantCode  codes.Code
+	}{
+		{
+			name:      "allowed",
+			client:    client,
+			method:    testMethod,
+			principal: "user:alice@example.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "denied",
+			client:    client,
+			method:    testMethod,
+			principal: "user:bob@example.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.PermissionDenied,
+		},
+		{
+			name:      "missing resource",
+			client:    client,
+			method:    testMethod,
+			principal: "user:alice@example.com",
+			req:       &iampb.GetIamPolicyRequest{},
+			wantCode:  codes.InvalidArgument,
+		},
+		{
+			name:      "unmapped denied by default",
+			client:    client,
+			method:    "/google.iam.v1.IAMPolicy/SetIamPolicy",
+			principal: "user:alice@example.com",
+			req:       &iampb.SetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.PermissionDenied,
+		},
+		{
+			name:      "unmapped allowed",
+			client:    client,
+			method:    "/google.iam.v1.IAMPolicy/SetIamPolicy",
+			principal: "user:bob@example.com",
+			req:       &iampb.SetIamPolicyRequest{Resource: "projects/test-project"},
+			opts:      []EnforceOption{WithUnmappedPolicy(UnmappedAllow)},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "unmapped error",
+			client:    client,
+			method:    "/google.iam.v1.IAMPolicy/SetIamPolicy",
+			principal: "user:alice@example.com",
+			req:       &iampb.SetIamPolicyRequest{Resource: "projects/test-project"},
+			opts:      []EnforceOption{WithUnmappedPolicy(UnmappedError)},
+			wantCode:  codes.Internal,
+		},
+		{
+			name:      "malformed principal",
+			client:    client,
+			method:    testMethod,
+			principal: "serviceaccount:app@test-project.iam.gserviceaccount.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.InvalidArgument,
+		},
+		{
+			name:      "malformed principal allowed in audit mode",
+			client:    auditClient,
+			method:    testMethod,
+			principal: "alice@example.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "malformed principal allowed in off mode",
+			client:    offClient,
+			method:    testMethod,
+			principal: "serviceaccount:app@test-project.iam.gserviceaccount.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "principal extractor",
+			client:    client,
+			method:    testMethod,
+			principal: "user:bob@example.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			opts:      []EnforceOption{WithPrincipalExtractor(StaticPrincipal("user:alice@example.com"))},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "nil client disables enforcement",
+			client:    nil,
+			method:    testMethod,
+			principal: "user:bob@example.com",
+			req:       &iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "off mode skips unmapped policy",
+			client:    offClient,
+			method:    "/google.iam.v1.IAMPolicy/SetIamPolicy",
+			principal: "user:bob@example.com",
+			req:       &iampb.SetIamPolicyRequest{Resource: "projects/test-project"},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "off mode skips resource extraction",
+			client:    offClient,
+			method:    testMethod,
+			principal: "user:bob@example.com",
+			req:       &iampb.GetIamPolicyRequest{},
+			wantCode:  codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := UnaryServerInterceptor(tt.client, testRules, tt.opts...)
+
+			called := false
+			handler := func(ctx context.Context, req any) (any, error) {
+				called = true
+				return "ok", nil
+			}
+
+			_, err := interceptor(incomingPrincipal(tt.principal), tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("interceptor error = %v, want code %v", err, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCode == codes.OK)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_DeniedDetails(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	interceptor := UnaryServerInterceptor(newTestClient(t, addr, AuthModeStrict), testRules)
+
+	_, err := interceptor(
+		incomingPrincipal("user:bob@example.com"),
+		&iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+		&grpc.UnaryServerInfo{FullMethod: testMethod},
+		func(ctx context.Context, req any) (any, error) { return nil, nil },
+	)
+
+	// Denials carry the same ErrorInfo real GCP returns
+	st := status.Convert(err)
+	if len(st.Details()) != 1 {
+		t.Fatalf("denial details = %v, want ErrorInfo", st.Details())
+	}
+	if st.Message() != "Permission 'resourcemanager.projects.getIamPolicy' denied for resource 'projects/test-project' (or it may not exist)." {
+		t.Errorf("denial message = %q", st.Message())
+	}
+}
+
+func TestUnaryServerInterceptor_RuleWithoutResource(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	interceptor := UnaryServerInterceptor(newTestClient(t, addr, AuthModeStrict), MethodRules{
+		testMethod: {Permission: "resourcemanager.projects.getIamPolicy"},
+	})
+
+	_, err := interceptor(
+		incomingPrincipal("user:alice@example.com"),
+		&iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+		&grpc.UnaryServerInfo{FullMethod: testMethod},
+		func(ctx context.Context, req any) (any, error) { return nil, nil },
+	)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("interceptor error = %v, want Internal", err)
+	}
+}
+
+func TestUnaryServerInterceptor_IAMErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		mode     AuthMode
+		resource string
+		wantCode codes.Code
+	}{
+		{"strict unreachable", "localhost:9999", AuthModeStrict, "projects/test-project", codes.Unavailable},
+		{"permissive unreachable fails open", "localhost:9999", AuthModePermissive, "projects/test-project", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.host, tt.mode)
+			interceptor := UnaryServerInterceptor(client, testRules)
+
+			_, err := interceptor(
+				incomingPrincipal("user:alice@example.com"),
+				&iampb.GetIamPolicyRequest{Resource: tt.resource},
+				&grpc.UnaryServerInfo{FullMethod: testMethod},
+				func(ctx context.Context, req any) (any, error) { return nil, nil },
+			)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("interceptor error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("config error", func(t *testing.T) {
+		fake, addr := startFakeIAMServer(t)
+		fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+			return nil, status.Error(codes.InvalidArgument, "bad resource")
+		})
+		interceptor := UnaryServerInterceptor(newTestClient(t, addr, AuthModePermissive), testRules)
+
+		_, err := interceptor(
+			incomingPrincipal("user:alice@example.com"),
+			&iampb.GetIamPolicyRequest{Resource: "projects/test-project"},
+			&grpc.UnaryServerInfo{FullMethod: testMethod},
+			func(ctx context.Context, req any) (any, error) { return nil, nil },
+		)
+		if status.Code(err) != codes.Internal {
+			t.Errorf("interceptor error = %v, want Internal", err)
+		}
+	})
+}
+
+// fakeServerStream replays queued requests and records sent responses
+type fakeServerStream struct {
+	grpc.ServerStream
+
+	ctx      context.Context
+	requests []*iampb.GetIamPolicyRequest
+	sent     int
+}
+
+func (s *fakeServerStream) Context() context.Context { return s.ctx }
+
+func (s *fakeServerStream) RecvMsg(m any) error {
+	if len(s.requests) == 0 {
+		return io.EOF
+	}
+	m.(*iampb.GetIamPolicyRequest).Resource = s.requests[0].Resource
+	s.requests = s.requests[1:]
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(m any) error {
+	s.sent++
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	fake, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+
+	// Echo handler: receive every request and send a response for each
+	echo := func(srv any, ss grpc.ServerStream) error {
+		for {
+			req := &iampb.GetIamPolicyRequest{}
+			if err := ss.RecvMsg(req); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := ss.SendMsg(req); err != nil {
+				return err
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal string
+		handler   grpc.StreamHandler
+		wantCode  codes.Code
+		wantSent  int
+	}{
+		{"allowed", testMethod, "user:alice@example.com", echo, codes.OK, 2},
+		{"denied on first message", testMethod, "user:bob@example.com", echo, codes.PermissionDenied, 0},
+		{"unmapped", "/google.iam.v1.IAMPolicy/Watch", "user:alice@example.com", echo, codes.PermissionDenied, 0},
+		{
+			name:      "send before receive needs a request",
+			method:    testMethod,
+			principal: "user:alice@example.com",
+			handler: func(srv any, ss grpc.ServerStream) error {
+				return ss.SendMsg(&iampb.GetIamPolicyRequest{})
+			},
+			wantCode: codes.InvalidArgument,
+			wantSent: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &fakeServerStream{
+				ctx: incomingPrincipal(tt.principal),
+				requests: []*iampb.GetIamPolicyRequest{
+					{Resource: "projects/test-project"},
+					{Resource: "projects/test-project"},
+				},
+			}
+
+			before := fake.Calls()
+			err := StreamServerInterceptor(client, testRules)(nil, ss, &grpc.StreamServerInfo{FullMethod: tt.method}, tt.handler)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("interceptor error = %v, want code %v", err, tt.wantCode)
+			}
+			if ss.sent != tt.wantSent {
+				t.Errorf("sent = %d, want %d", ss.sent, tt.wantSent)
+			}
+			// The stream is checked once, not per message
+			if calls := fake.Calls() - before; calls > 1 {
+				t.Errorf("IAM calls = %d, want at most 1", calls)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor_SwitchedOff(t *testing.T) {
+	fake, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+	interceptor := StreamServerInterceptor(client, testRules)
+
+	handler := func(srv any, ss grpc.ServerStream) error {
+		return ss.SendMsg(&iampb.GetIamPolicyRequest{})
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/google.iam.v1.IAMPolicy/Watch"}
+
+	if err := interceptor(nil, &fakeServerStream{ctx: incomingPrincipal("user:bob@example.com")}, info, handler); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("strict mode error = %v, want PermissionDenied", err)
+	}
+
+	// Switching the live client off lets every stream through unchecked
+	if err := client.SetMode(AuthModeOff); err != nil {
+		t.Fatal(err)
+	}
+	ss := &fakeServerStream{ctx: incomingPrincipal("user:bob@example.com")}
+	if err := interceptor(nil, ss, info, handler); err != nil {
+		t.Errorf("off mode error = %v, want nil", err)
+	}
+	if ss.sent != 1 {
+		t.Errorf("sent = %d, want 1", ss.sent)
+	}
+	if calls := fake.Calls(); calls != 0 {
+		t.Errorf("IAM calls = %d, want 0", calls)
+	}
+}
+
+func TestResourceField(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		req     any
+		want    string
+		wantErr bool
+	}{
+		{"string field", "resource", &iampb.GetIamPolicyRequest{Resource: "projects/p"}, "projects/p", false},
+		{"empty field", "resource", &iampb.GetIamPolicyRequest{}, "", true},
+		{"unknown field", "name", &iampb.GetIamPolicyRequest{Resource: "projects/p"}, "", true},
+		{"non-string field", "options", &iampb.GetIamPolicyRequest{Resource: "projects/p"}, "", true},
+		{"nested non-string field", "options.requested_policy_version", &iampb.GetIamPolicyRequest{Options: &iampb.GetPolicyOptions{}}, "", true},
+		{"nested through scalar", "resource.name", &iampb.GetIamPolicyRequest{Resource: "projects/p"}, "", true},
+		{"not a proto", "resource", "projects/p", "", true},
+		{"nil request", "resource", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResourceField(tt.path)(context.Background(), tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResourceField(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResourceField(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticResource(t *testing.T) {
+	got, err := StaticResource("projects/test-project")(context.Background(), nil)
+	if err != nil || got != "projects/test-project" {
+		t.Errorf("StaticResource() = %q, %v", got, err)
+	}
+}
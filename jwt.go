@@ -0,0 +1,88 @@
+package emulatorauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// AuthorizationMetadataKey is the gRPC metadata key for bearer tokens
+	AuthorizationMetadataKey = "authorization"
+
+	// AuthorizationHeaderKey is the HTTP header key for bearer tokens
+	AuthorizationHeaderKey = "Authorization"
+)
+
+// serviceAccountDomain is the email suffix of Google service accounts
+// (project.iam.gserviceaccount.com, developer.gserviceaccount.com, ...)
+const serviceAccountDomain = ".gserviceaccount.com"
+
+// jwtClaims holds the JWT claims used to derive a principal
+type jwtClaims struct {
+	Email string `json:"email"`
+}
+
+// PrincipalFromJWT returns the principal for the email claim of a JWT, such
+// as an identity token from the emulator's metadata server or
+// `gcloud auth print-identity-token`. Google service account emails map to
+// serviceAccount:, any other email to user:.
+//
+// Neither the signature nor the expiry is verified: the emulator trusts the
+// caller's claimed identity, as it does for X-Emulator-Principal. Unsigned
+// ("alg": "none") tokens are accepted.
+func PrincipalFromJWT(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed JWT: want header.payload.signature")
+	}
+
+	var header map[string]any
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("malformed JWT header: %w", err)
+	}
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("malformed JWT payload: %w", err)
+	}
+
+	if claims.Email == "" {
+		return "", errors.New("JWT has no email claim")
+	}
+	return principalFromEmail(claims.Email), nil
+}
+
+// principalFromEmail maps Google service account emails to serviceAccount:
+// and any other email to user:
+func principalFromEmail(email string) string {
+	if strings.HasSuffix(strings.ToLower(email), serviceAccountDomain) {
+		return "serviceAccount:" + email
+	}
+	return "user:" + email
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// principalFromAuthorization returns the principal for a "Bearer <JWT>"
+// authorization value, or "" if it isn't one. Opaque access tokens
+// (ya29....) carry no identity and are ignored.
+func principalFromAuthorization(authorization string) string {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	principal, err := PrincipalFromJWT(strings.TrimSpace(token))
+	if err != nil {
+		return ""
+	}
+	return principal
+}
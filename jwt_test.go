@@ -0,0 +1,122 @@
+package emulatorauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// makeJWT builds a token with the given claims and a dummy signature; pass
+// an empty signature for an unsigned ("alg": "none") token
+func makeJWT(t *testing.T, claims map[string]any, signature string) string {
+	t.Helper()
+
+	alg := "RS256"
+	if signature == "" {
+		alg = "none"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+}
+
+func TestPrincipalFromJWT(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "user email",
+			token: makeJWT(t, map[string]any{"email": "alice@example.com", "sub": "123"}, "c2ln"),
+			want:  "user:alice@example.com",
+		},
+		{
+			name:  "service account email",
+			token: makeJWT(t, map[string]any{"email": "app@test-project.iam.gserviceaccount.com"}, "c2ln"),
+			want:  "serviceAccount:app@test-project.iam.gserviceaccount.com",
+		},
+		{
+			name:  "default compute service account",
+			token: makeJWT(t, map[string]any{"email": "123-compute@developer.gserviceaccount.com"}, "c2ln"),
+			want:  "serviceAccount:123-compute@developer.gserviceaccount.com",
+		},
+		{
+			name:  "unsigned token",
+			token: makeJWT(t, map[string]any{"email": "alice@example.com"}, ""),
+			want:  "user:alice@example.com",
+		},
+		{
+			name:    "no email claim",
+			token:   makeJWT(t, map[string]any{"sub": "123"}, "c2ln"),
+			wantErr: true,
+		},
+		{
+			name:    "opaque access token",
+			token:   "ya29.a0AfH6SMB",
+			wantErr: true,
+		},
+		{
+			name:    "payload not JSON",
+			token:   "eyJhbGciOiJub25lIn0.bm90IGpzb24.",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PrincipalFromJWT(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PrincipalFromJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PrincipalFromJWT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPrincipal_BearerToken(t *testing.T) {
+	token := makeJWT(t, map[string]any{"email": "app@test-project.iam.gserviceaccount.com"}, "c2ln")
+	const want = "serviceAccount:app@test-project.iam.gserviceaccount.com"
+
+	tests := []struct {
+		name          string
+		authorization string
+		principal     string
+		want          string
+	}{
+		{name: "bearer JWT", authorization: "Bearer " + token, want: want},
+		{name: "lowercase scheme", authorization: "bearer " + token, want: want},
+		{name: "emulator principal wins", authorization: "Bearer " + token, principal: "user:alice@example.com", want: "user:alice@example.com"},
+		{name: "opaque access token", authorization: "Bearer ya29.a0AfH6SMB", want: ""},
+		{name: "basic auth", authorization: "Basic YWxpY2U6c2VjcmV0", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{AuthorizationMetadataKey: []string{tt.authorization}}
+			req := &http.Request{Header: http.Header{AuthorizationHeaderKey: []string{tt.authorization}}}
+			if tt.principal != "" {
+				md.Set(PrincipalMetadataKey, tt.principal)
+				req.Header.Set(PrincipalHeaderKey, tt.principal)
+			}
+
+			if got := ExtractPrincipalFromContext(metadata.NewIncomingContext(context.Background(), md)); got != tt.want {
+				t.Errorf("ExtractPrincipalFromContext() = %q, want %q", got, tt.want)
+			}
+			if got := ExtractPrincipalFromRequest(req); got != tt.want {
+				t.Errorf("ExtractPrincipalFromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
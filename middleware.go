@@ -0,0 +1,168 @@
+package emulatorauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestResourceFunc extracts the IAM resource name from an HTTP request
+type RequestResourceFunc func(r *http.Request) (string, error)
+
+// Route is the permission an HTTP endpoint requires
+type Route struct {
+	// Pattern uses http.ServeMux syntax, e.g.
+	// "POST /v1/projects/{project}/secrets/{secret}:access". A wildcard may be
+	// followed by a Google API custom verb (":access"), which ServeMux itself
+	// does not support.
+	Pattern string
+
+	Permission string
+	Resource   RequestResourceFunc
+}
+
+// ResourceTemplate returns a RequestResourceFunc that fills a template such as
+// "projects/{project}/secrets/{secret}" from the matched route's wildcards
+func ResourceTemplate(template string) RequestResourceFunc {
+	return func(r *http.Request) (string, error) {
+		var b strings.Builder
+		rest := template
+		for {
+			start := strings.Index(rest, "{")
+			if start < 0 {
+				b.WriteString(rest)
+				return b.String(), nil
+			}
+			end := strings.Index(rest[start:], "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated wildcard in resource template %q", template)
+			}
+			end += start
+
+			name := strings.TrimSuffix(rest[start+1:end], "...")
+			value := r.PathValue(name)
+			if value == "" {
+				return "", fmt.Errorf("missing path value %q for resource template %q", name, template)
+			}
+
+			b.WriteString(rest[:start])
+			b.WriteString(value)
+			rest = rest[end+1:]
+		}
+	}
+}
+
+type compiledRoute struct {
+	Route
+	pattern *routePattern
+}
+
+// Middleware returns net/http middleware that enforces IAM on REST
+// emulators. Each request is matched against the routes in order; the first
+// match decides the permission and, through its wildcards (also exposed via
+// r.PathValue), the resource. The principal comes from
+// WithPrincipalExtractor (ExtractPrincipalFromRequest by default); handlers
+// of checked requests can read it and the decision back with
+// PrincipalFromContext and DecisionFromContext. Denials are written as
+// Google-style JSON errors with ErrorInfo details. A nil client or one in
+// AuthModeOff disables enforcement.
+//
+// Like http.ServeMux.Handle, Middleware panics on an invalid pattern.
+func Middleware(client *Client, routes []Route, opts ...EnforceOption) func(http.Handler) http.Handler {
+	e := newEnforcer(client, opts)
+
+	compiled := make([]compiledRoute, 0, len(routes))
+	for _, route := range routes {
+		pattern, err := parseRoutePattern(route.Pattern)
+		if err != nil {
+			panic(fmt.Sprintf("emulatorauth: %v", err))
+		}
+		compiled = append(compiled, compiledRoute{Route: route, pattern: pattern})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !e.enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r, err := e.authorizeRequest(compiled, r)
+			if err != nil {
+				WriteHTTPError(w, status.Convert(err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeRequest enforces the first matching route against the request and
+// returns the request to pass on: for a checked route, a copy carrying its
+// path values and the principal and decision. The caller's request is never
+// modified.
+func (e *enforcer) authorizeRequest(routes []compiledRoute, r *http.Request) (*http.Request, error) {
+	for _, route := range routes {
+		values, ok := route.pattern.match(r)
+		if !ok {
+			continue
+		}
+
+		// Clone rather than WithContext: a shallow copy would share the path
+		// values a ServeMux in front of us may have set
+		r = r.Clone(r.Context())
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+
+		if route.Resource == nil {
+			return r, status.Errorf(codes.Internal, "IAM route %q has no resource extractor", route.Pattern)
+		}
+		resource, err := route.Resource(r)
+		if err != nil {
+			return r, status.Errorf(codes.InvalidArgument, "cannot determine IAM resource: %v", err)
+		}
+
+		ctx, err := e.authorize(r.Context(), e.principals.ExtractFromRequest(r), resource, route.Permission)
+		if err != nil {
+			return r, err
+		}
+		return r.WithContext(ctx), nil
+	}
+
+	return r, e.authorizeUnmapped(r.Method + " " + r.URL.Path)
+}
+
+// HTTPStatusFromCode maps a gRPC code to the HTTP status Google REST APIs use
+func HTTPStatusFromCode(c codes.Code) int {
+	switch c {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
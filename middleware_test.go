@@ -0,0 +1,359 @@
+package emulatorauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+)
+
+var testRoutes = []Route{
+	{
+		Pattern:    "GET /v1/projects/{project}/secrets/{secret}",
+		Permission: "secretmanager.secrets.get",
+		Resource:   ResourceTemplate("projects/{project}/secrets/{secret}"),
+	},
+	{
+		Pattern:    "POST /v1/projects/{project}/secrets/{secret}/versions/{version}:access",
+		Permission: "secretmanager.versions.access",
+		Resource:   ResourceTemplate("projects/{project}/secrets/{secret}/versions/{version}"),
+	},
+}
+
+func TestMiddleware(t *testing.T) {
+	fake, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+
+	var gotResource string
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		gotResource = req.Resource
+		if ExtractPrincipalFromContext(ctx) != "user:alice@example.com" {
+			return &iampb.TestIamPermissionsResponse{}, nil
+		}
+		return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		principal    string
+		opts         []EnforceOption
+		wantCode     int
+		wantStatus   string
+		wantResource string
+	}{
+		{
+			name:         "allowed",
+			method:       http.MethodGet,
+			target:       "/v1/projects/test-project/secrets/db-password",
+			principal:    "user:alice@example.com",
+			wantCode:     http.StatusOK,
+			wantResource: "projects/test-project/secrets/db-password",
+		},
+		{
+			name:         "allowed custom verb",
+			method:       http.MethodPost,
+			target:       "/v1/projects/test-project/secrets/db-password/versions/latest:access",
+			principal:    "user:alice@example.com",
+			wantCode:     http.StatusOK,
+			wantResource: "projects/test-project/secrets/db-password/versions/latest",
+		},
+		{
+			name:         "denied",
+			method:       http.MethodGet,
+			target:       "/v1/projects/test-project/secrets/db-password",
+			principal:    "user:bob@example.com",
+			wantCode:     http.StatusForbidden,
+			wantStatus:   "PERMISSION_DENIED",
+			wantResource: "projects/test-project/secrets/db-password",
+		},
+		{
+			name:       "unmapped denied",
+			method:     http.MethodDelete,
+			target:     "/v1/projects/test-project/secrets/db-password",
+			principal:  "user:alice@example.com",
+			wantCode:   http.StatusForbidden,
+			wantStatus: "PERMISSION_DENIED",
+		},
+		{
+			name:       "malformed principal",
+			method:     http.MethodGet,
+			target:     "/v1/projects/test-project/secrets/db-password",
+			principal:  "alice@example.com",
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "INVALID_ARGUMENT",
+		},
+		{
+			name:         "principal from query param",
+			method:       http.MethodGet,
+			target:       "/v1/projects/test-project/secrets/db-password?principal=user:alice@example.com",
+			principal:    "user:bob@example.com",
+			opts:         []EnforceOption{WithPrincipalExtractor(ChainPrincipalExtractors(PrincipalQueryParam("principal"), PrincipalHeader()))},
+			wantCode:     http.StatusOK,
+			wantResource: "projects/test-project/secrets/db-password",
+		},
+		{
+			name:      "unmapped allowed",
+			method:    http.MethodDelete,
+			target:    "/v1/projects/test-project/secrets/db-password",
+			principal: "user:bob@example.com",
+			opts:      []EnforceOption{WithUnmappedPolicy(UnmappedAllow)},
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:       "unmapped error",
+			method:     http.MethodDelete,
+			target:     "/v1/projects/test-project/secrets/db-password",
+			principal:  "user:alice@example.com",
+			opts:       []EnforceOption{WithUnmappedPolicy(UnmappedError)},
+			wantCode:   http.StatusInternalServerError,
+			wantStatus: "INTERNAL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResource = ""
+
+			var pathSecret string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pathSecret = r.PathValue("secret")
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(PrincipalHeaderKey, tt.principal)
+			rec := httptest.NewRecorder()
+
+			Middleware(client, testRoutes, tt.opts...)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if gotResource != tt.wantResource {
+				t.Errorf("IAM resource = %q, want %q", gotResource, tt.wantResource)
+			}
+
+			if tt.wantCode == http.StatusOK {
+				if tt.wantResource != "" && pathSecret != "db-password" {
+					t.Errorf("PathValue(secret) = %q, want db-password", pathSecret)
+				}
+				return
+			}
+
+			var body httpError
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error body: %v", err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Status != tt.wantStatus || body.Error.Message == "" {
+				t.Errorf("error body = %+v, want code %d status %s", body.Error, tt.wantCode, tt.wantStatus)
+			}
+			// IAM denials carry ErrorInfo, policy rejections don't
+			if wantDetails := tt.wantResource != ""; (len(body.Error.Details) > 0) != wantDetails {
+				t.Errorf("details = %s, want details %v", body.Error.Details, wantDetails)
+			}
+		})
+	}
+}
+
+func TestMiddleware_IAMUnavailable(t *testing.T) {
+	client := newTestClient(t, "localhost:9999", AuthModeStrict)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+	req.Header.Set(PrincipalHeaderKey, "user:alice@example.com")
+	rec := httptest.NewRecorder()
+
+	Middleware(client, testRoutes)(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d, want 503", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestMiddleware_NilClient(t *testing.T) {
+	rec := httptest.NewRecorder()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	Middleware(nil, testRoutes)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/anything", nil))
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status code = %d, nil client should pass through", rec.Code)
+	}
+}
+
+func TestMiddleware_OffMode(t *testing.T) {
+	fake, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+	handler := Middleware(client, testRoutes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("strict mode status code = %d, want 403", rec.Code)
+	}
+
+	// Switching the live client off lets unmapped and unchecked requests through
+	if err := client.SetMode(AuthModeOff); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/healthz", "/v1/projects/test-project/secrets/db-password"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("GET %s status code = %d, off mode should pass through", target, rec.Code)
+		}
+	}
+	if calls := fake.Calls(); calls != 0 {
+		t.Errorf("IAM calls = %d, want 0", calls)
+	}
+}
+
+func TestMiddleware_DoesNotModifyRequest(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+
+	var pathSecret string
+	handler := Middleware(client, testRoutes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSecret = r.PathValue("secret")
+	}))
+
+	for _, principal := range []string{"user:alice@example.com", "user:bob@example.com"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+		req.Header.Set(PrincipalHeaderKey, principal)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.PathValue("secret"); got != "" {
+			t.Errorf("%s: caller's PathValue(secret) = %q, want it unset", principal, got)
+		}
+	}
+	if pathSecret != "db-password" {
+		t.Errorf("handler PathValue(secret) = %q, want db-password", pathSecret)
+	}
+}
+
+func TestMiddleware_MalformedPrincipal(t *testing.T) {
+	_, addr := startAliceOnlyIAMServer(t)
+
+	tests := []struct {
+		mode     AuthMode
+		wantCode int
+	}{
+		{AuthModeStrict, http.StatusBadRequest},
+		{AuthModeAudit, http.StatusOK},
+		{AuthModeOff, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			client := newTestClient(t, addr, tt.mode)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+			req.Header.Set(PrincipalHeaderKey, "alice@example.com")
+			rec := httptest.NewRecorder()
+
+			Middleware(client, testRoutes)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMiddleware_InvalidPatternPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Middleware should panic on an invalid pattern")
+		}
+	}()
+	Middleware(nil, []Route{{Pattern: "/v1/{name"}})
+}
+
+func TestMiddleware_WithServeMux(t *testing.T) {
+	// The middleware wraps a Go 1.22 ServeMux using the same pattern syntax
+	_, addr := startAliceOnlyIAMServer(t)
+	client := newTestClient(t, addr, AuthModeStrict)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/projects/{project}/secrets/{secret}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.PathValue("project") + "/" + r.PathValue("secret")))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/projects/test-project/secrets/db-password", nil)
+	req.Header.Set(PrincipalHeaderKey, "user:alice@example.com")
+	rec := httptest.NewRecorder()
+
+	Middleware(client, testRoutes)(mux).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "test-project/db-password" {
+		t.Errorf("response = %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestResourceTemplate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetPathValue("project", "p1")
+	req.SetPathValue("name", "a/b")
+
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"projects/{project}", "projects/p1", false},
+		{"projects/{project}/secrets/{name...}", "projects/p1/secrets/a/b", false},
+		{"projects/static", "projects/static", false},
+		{"projects/{missing}", "", true},
+		{"projects/{project", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := ResourceTemplate(tt.template)(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResourceTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResourceTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	tests := []struct {
+		code     codes.Code
+		expected int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.Unknown, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := HTTPStatusFromCode(tt.code); got != tt.expected {
+				t.Errorf("HTTPStatusFromCode(%v) = %d, want %d", tt.code, got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package emulatorauth
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // AuthMode defines how IAM authorization is enforced
 type AuthMode string
@@ -22,25 +25,90 @@ const (
 	// - Config errors: deny
 	// Recommended for CI/CD to catch permission issues
 	AuthModeStrict AuthMode = "strict"
+
+	// AuthModeAudit enables IAM checks without enforcing them:
+	// - Checks are evaluated as in strict mode
+	// - Every check is allowed
+	// - Would-be denials are reported through WithAuditFunc/WithAuditTrace
+	// Use to roll out enforcement on existing test suites
+	AuthModeAudit AuthMode = "audit"
 )
 
-// ParseAuthMode parses an auth mode from string (case-insensitive)
+// ParseAuthMode parses an auth mode from string (case-insensitive).
+// Unknown values, including typos, return AuthModeOff; use
+// ParseAuthModeStrict to reject them.
 func ParseAuthMode(s string) AuthMode {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "permissive":
 		return AuthModePermissive
 	case "strict":
 		return AuthModeStrict
+	case "audit", "dryrun":
+		return AuthModeAudit
 	default:
 		return AuthModeOff
 	}
 }
 
+// ParseAuthModeStrict parses an auth mode from string (case-insensitive),
+// returning an error for empty or unknown values instead of AuthModeOff
+func ParseAuthModeStrict(s string) (AuthMode, error) {
+	mode := normalizeAuthMode(s)
+	if !mode.isValid() {
+		return "", fmt.Errorf("unknown auth mode %q (want off, permissive, strict or audit)", s)
+	}
+	return mode, nil
+}
+
+// normalizeAuthMode lower-cases and trims a mode and resolves aliases without
+// defaulting unknown values to off the way ParseAuthMode does
+func normalizeAuthMode(s string) AuthMode {
+	mode := AuthMode(strings.ToLower(strings.TrimSpace(s)))
+	if mode == "dryrun" {
+		return AuthModeAudit
+	}
+	return mode
+}
+
 // String returns the string representation of the auth mode
 func (m AuthMode) String() string {
 	return string(m)
 }
 
+// MarshalText implements encoding.TextMarshaler
+func (m AuthMode) MarshalText() ([]byte, error) {
+	return []byte(m), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler with
+// ParseAuthModeStrict, so config decoders reject unknown modes
+func (m *AuthMode) UnmarshalText(text []byte) error {
+	mode, err := ParseAuthModeStrict(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Set implements flag.Value with ParseAuthModeStrict, e.g.
+//
+//	mode := emulatorauth.AuthModeOff
+//	flag.Var(&mode, "iam-mode", "IAM mode (off, permissive, strict, audit)")
+func (m *AuthMode) Set(s string) error {
+	return m.UnmarshalText([]byte(s))
+}
+
+// isValid returns true for the known modes
+func (m AuthMode) isValid() bool {
+	switch m {
+	case AuthModeOff, AuthModePermissive, AuthModeStrict, AuthModeAudit:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsEnabled returns true if IAM checks are enabled (not off)
 func (m AuthMode) IsEnabled() bool {
 	return m != AuthModeOff
@@ -1,6 +1,11 @@
 package emulatorauth
 
-import "testing"
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"testing"
+)
 
 func TestParseAuthMode(t *testing.T) {
 	tests := []struct {
@@ -12,6 +17,8 @@ func TestParseAuthMode(t *testing.T) {
 		{"lowercase permissive", "permissive", AuthModePermissive},
 		{"lowercase strict", "strict", AuthModeStrict},
 		{"lowercase off", "off", AuthModeOff},
+		{"lowercase audit", "audit", AuthModeAudit},
+		{"dryrun alias", "dryrun", AuthModeAudit},
 
 		// Case insensitive
 		{"uppercase PERMISSIVE", "PERMISSIVE", AuthModePermissive},
@@ -19,6 +26,7 @@ func TestParseAuthMode(t *testing.T) {
 		{"uppercase OFF", "OFF", AuthModeOff},
 		{"mixed case Permissive", "Permissive", AuthModePermissive},
 		{"mixed case StRiCt", "StRiCt", AuthModeStrict},
+		{"uppercase DRYRUN", "DRYRUN", AuthModeAudit},
 
 		// Whitespace handling
 		{"leading space", "  permissive", AuthModePermissive},
@@ -50,6 +58,7 @@ func TestAuthModeString(t *testing.T) {
 		{AuthModeOff, "off"},
 		{AuthModePermissive, "permissive"},
 		{AuthModeStrict, "strict"},
+		{AuthModeAudit, "audit"},
 	}
 
 	for _, tt := range tests {
@@ -70,6 +79,7 @@ func TestAuthModeIsEnabled(t *testing.T) {
 		{AuthModeOff, false},
 		{AuthModePermissive, true},
 		{AuthModeStrict, true},
+		{AuthModeAudit, true},
 	}
 
 	for _, tt := range tests {
@@ -81,3 +91,67 @@ func TestAuthModeIsEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAuthModeStrict(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected AuthMode
+		wantErr  bool
+	}{
+		{"off", AuthModeOff, false},
+		{" Permissive ", AuthModePermissive, false},
+		{"STRICT", AuthModeStrict, false},
+		{"audit", AuthModeAudit, false},
+		{"DryRun", AuthModeAudit, false},
+		{"strcit", "", true},
+		{"", "", true},
+		{"permi", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAuthModeStrict(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAuthModeStrict(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseAuthModeStrict(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAuthModeText(t *testing.T) {
+	var cfg struct {
+		Mode AuthMode `json:"mode"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"mode":"Strict"}`), &cfg); err != nil || cfg.Mode != AuthModeStrict {
+		t.Errorf("Unmarshal() = %v, %v, want strict", cfg.Mode, err)
+	}
+	if err := json.Unmarshal([]byte(`{"mode":"strcit"}`), &cfg); err == nil {
+		t.Error("Unmarshal() should reject an unknown mode")
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil || string(data) != `{"mode":"strict"}` {
+		t.Errorf("Marshal() = %s, %v", data, err)
+	}
+}
+
+func TestAuthModeFlag(t *testing.T) {
+	mode := AuthModeOff
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&mode, "iam-mode", "IAM mode")
+
+	if err := fs.Parse([]string{"-iam-mode", "permissive"}); err != nil || mode != AuthModePermissive {
+		t.Errorf("Parse() = %v, %v, want permissive", mode, err)
+	}
+	if err := fs.Parse([]string{"-iam-mode", "strcit"}); err == nil {
+		t.Error("Parse() should reject an unknown mode")
+	}
+	if mode != AuthModePermissive {
+		t.Errorf("mode = %v after rejected flag, want permissive", mode)
+	}
+}
@@ -0,0 +1,136 @@
+package emulatorauth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultTimeout is the per-check timeout used when WithTimeout is not given
+const DefaultTimeout = 2 * time.Second
+
+// Option configures a Client created by NewClient
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	timeout       time.Duration
+	creds         credentials.TransportCredentials
+	tls           *TLSConfig
+	userAgent     string
+	dialOptions   []grpc.DialOption
+	cache         *CacheConfig
+	retry         RetryPolicy
+	breaker       *BreakerConfig
+	errorPolicy   ErrorPolicy
+	auditFunc     AuditFunc
+	auditTrace    *trace.Writer
+	modeOverrides ModeOverrides
+	modeChange    ModeChangeFunc
+
+	anonymousPolicy  AnonymousPolicy
+	defaultPrincipal string
+}
+
+func defaultClientOptions() clientOptions {
+	return clientOptions{
+		timeout: DefaultTimeout,
+		creds:   insecure.NewCredentials(),
+	}
+}
+
+// WithTimeout sets the timeout applied to each IAM call (default 2s)
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTransportCredentials replaces the default insecure transport credentials,
+// e.g. to reach an IAM emulator behind a TLS sidecar. It replaces any earlier
+// WithTLS.
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *clientOptions) {
+		o.creds = creds
+		o.tls = nil
+	}
+}
+
+// WithUserAgent sets the user agent sent to the IAM emulator
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithDialOptions appends raw gRPC dial options. They are applied after the
+// options derived from WithTransportCredentials and WithUserAgent, so they win
+// on conflict.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *clientOptions) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// resolve turns deferred settings (TLS files) into concrete options
+func (o *clientOptions) resolve() error {
+	if o.timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", o.timeout)
+	}
+
+	if o.tls != nil {
+		creds, err := o.tls.TransportCredentials()
+		if err != nil {
+			return err
+		}
+		o.creds = creds
+	}
+
+	if o.cache != nil {
+		if err := o.cache.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := o.retry.validate(); err != nil {
+		return err
+	}
+
+	if o.breaker != nil {
+		if err := o.breaker.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := o.errorPolicy.validate(); err != nil {
+		return err
+	}
+
+	if err := o.modeOverrides.validate(); err != nil {
+		return err
+	}
+
+	if err := o.anonymousPolicy.validate(); err != nil {
+		return err
+	}
+
+	if o.defaultPrincipal != "" {
+		if _, err := ParsePrincipal(o.defaultPrincipal); err != nil {
+			return fmt.Errorf("invalid default principal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// grpcDialOptions returns the dial options for grpc.NewClient
+func (o clientOptions) grpcDialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(o.creds)}
+	if o.userAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(o.userAgent))
+	}
+	return append(opts, o.dialOptions...)
+}
@@ -0,0 +1,101 @@
+package emulatorauth
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestDefaultClientOptions(t *testing.T) {
+	o := defaultClientOptions()
+
+	if o.timeout != DefaultTimeout {
+		t.Errorf("timeout = %v, want %v", o.timeout, DefaultTimeout)
+	}
+	if o.creds == nil || o.creds.Info().SecurityProtocol != "insecure" {
+		t.Errorf("creds = %v, want insecure", o.creds)
+	}
+	if got := len(o.grpcDialOptions()); got != 1 {
+		t.Errorf("grpcDialOptions() returned %d options, want 1", got)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	tlsCreds := credentials.NewTLS(&tls.Config{})
+
+	o := defaultClientOptions()
+	for _, opt := range []Option{
+		WithTimeout(10 * time.Second),
+		WithTransportCredentials(tlsCreds),
+		WithUserAgent("gcp-kms-emulator/1.0"),
+		WithDialOptions(grpc.WithAuthority("iam.local")),
+		WithDialOptions(grpc.WithDisableRetry()),
+	} {
+		opt(&o)
+	}
+
+	if o.timeout != 10*time.Second {
+		t.Errorf("timeout = %v, want %v", o.timeout, 10*time.Second)
+	}
+	if o.creds != tlsCreds {
+		t.Errorf("creds = %v, want TLS credentials", o.creds)
+	}
+	if o.userAgent != "gcp-kms-emulator/1.0" {
+		t.Errorf("userAgent = %q, want %q", o.userAgent, "gcp-kms-emulator/1.0")
+	}
+	if len(o.dialOptions) != 2 {
+		t.Errorf("dialOptions has %d entries, want 2", len(o.dialOptions))
+	}
+	// transport credentials + user agent + two raw dial options
+	if got := len(o.grpcDialOptions()); got != 4 {
+		t.Errorf("grpcDialOptions() returned %d options, want 4", got)
+	}
+}
+
+func TestNewClient_WithTimeout(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if client.timeout != 5*time.Second {
+		t.Errorf("Client timeout = %v, want %v", client.timeout, 5*time.Second)
+	}
+}
+
+func TestNewClient_InvalidTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		client, err := NewClient(iamEmulatorHost, AuthModeStrict, WithTimeout(timeout))
+		if err == nil {
+			client.Close()
+			t.Errorf("NewClient(WithTimeout(%v)) should return error", timeout)
+		}
+	}
+}
+
+func TestNewClient_WithTransportCredentials(t *testing.T) {
+	// The test emulator speaks plaintext, so a TLS handshake must fail
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict,
+		WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+		WithTimeout(500*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.CheckPermission(
+		context.Background(),
+		"user:test@example.com",
+		"projects/test-project/secrets/test-secret",
+		"secretmanager.secrets.get",
+	)
+	if !IsConnectivityError(err) {
+		t.Errorf("Expected connectivity error from TLS handshake against plaintext server, got: %v", err)
+	}
+}
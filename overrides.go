@@ -0,0 +1,122 @@
+package emulatorauth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ModeOverride applies Mode instead of the client mode to checks matching
+// Pattern. A pattern containing "/" matches the resource with path.Match
+// semantics ("projects/*/secrets/*"); any other pattern matches the
+// permission, with "*" matching any run of characters
+// ("secretmanager.versions.*", "*.list").
+type ModeOverride struct {
+	Pattern string
+	Mode    AuthMode
+}
+
+// ModeOverrides is an ordered override table; the first match wins
+type ModeOverrides []ModeOverride
+
+// WithModeOverrides sets per-permission or per-resource modes. Overrides
+// decide how IAM failures resolve (fail-open, fail-closed or audit) for the
+// checks they match; every check is still sent to IAM.
+func WithModeOverrides(overrides ModeOverrides) Option {
+	return func(o *clientOptions) {
+		o.modeOverrides = append(o.modeOverrides, overrides...)
+	}
+}
+
+// ParseModeOverrides parses a comma-separated list of pattern=mode entries,
+// e.g. "secretmanager.versions.*=strict,*.list=permissive"
+func ParseModeOverrides(s string) (ModeOverrides, error) {
+	var overrides ModeOverrides
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("mode override %q is not pattern=mode", entry)
+		}
+
+		overrides = append(overrides, ModeOverride{
+			Pattern: strings.TrimSpace(pattern),
+			Mode:    AuthMode(strings.ToLower(strings.TrimSpace(mode))),
+		})
+	}
+
+	if err := overrides.validate(); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+func (o ModeOverrides) validate() error {
+	for _, override := range o {
+		if override.Pattern == "" {
+			return fmt.Errorf("mode override for %q has an empty pattern", override.Mode)
+		}
+		switch override.Mode {
+		case AuthModePermissive, AuthModeStrict, AuthModeAudit:
+		default:
+			return fmt.Errorf("invalid mode %q for override %q (want permissive, strict or audit)", override.Mode, override.Pattern)
+		}
+		if override.isResource() {
+			if _, err := path.Match(override.Pattern, ""); err != nil {
+				return fmt.Errorf("invalid resource pattern %q: %w", override.Pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Mode returns the mode of the first override matching the check, or
+// fallback if none does
+func (o ModeOverrides) Mode(resource, permission string, fallback AuthMode) AuthMode {
+	for _, override := range o {
+		if override.matches(resource, permission) {
+			return override.Mode
+		}
+	}
+	return fallback
+}
+
+func (o ModeOverride) isResource() bool {
+	return strings.Contains(o.Pattern, "/")
+}
+
+func (o ModeOverride) matches(resource, permission string) bool {
+	if o.isResource() {
+		ok, _ := path.Match(o.Pattern, resource)
+		return ok
+	}
+	return matchWildcard(o.Pattern, permission)
+}
+
+// matchWildcard reports whether s matches pattern, where "*" matches any run
+// of characters (including dots) and everything else matches literally
+func matchWildcard(pattern, s string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == s
+	}
+
+	prefix := pattern[:star]
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	s = s[len(prefix):]
+	rest := pattern[star+1:]
+
+	// Try every split point for the star, shortest first
+	for i := 0; i <= len(s); i++ {
+		if matchWildcard(rest, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package emulatorauth
+
+import (
+	"context"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseModeOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ModeOverrides
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{
+			name:  "permission and resource patterns",
+			input: "secretmanager.versions.*=strict, *.list=Permissive,projects/*/secrets/legacy=audit",
+			want: ModeOverrides{
+				{Pattern: "secretmanager.versions.*", Mode: AuthModeStrict},
+				{Pattern: "*.list", Mode: AuthModePermissive},
+				{Pattern: "projects/*/secrets/legacy", Mode: AuthModeAudit},
+			},
+		},
+		{"missing mode", "*.list", nil, true},
+		{"unknown mode", "*.list=lenient", nil, true},
+		{"off not allowed", "*.list=off", nil, true},
+		{"empty pattern", "=strict", nil, true},
+		{"bad resource pattern", "projects/[/x=strict", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseModeOverrides(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseModeOverrides(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseModeOverrides(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseModeOverrides(%q)[%d] = %v, want %v", tt.input, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestModeOverridesMode(t *testing.T) {
+	overrides := ModeOverrides{
+		{Pattern: "secretmanager.versions.*", Mode: AuthModeStrict},
+		{Pattern: "*.list", Mode: AuthModePermissive},
+		{Pattern: "projects/*/secrets/legacy", Mode: AuthModeAudit},
+		{Pattern: "secretmanager.secrets.get", Mode: AuthModeStrict},
+	}
+
+	tests := []struct {
+		name       string
+		resource   string
+		permission string
+		want       AuthMode
+	}{
+		{"permission prefix", "projects/p/secrets/s", "secretmanager.versions.access", AuthModeStrict},
+		{"permission suffix", "projects/p/secrets/s", "secretmanager.secrets.list", AuthModePermissive},
+		{"first match wins", "projects/p/secrets/legacy", "secretmanager.versions.list", AuthModeStrict},
+		{"resource pattern", "projects/p/secrets/legacy", "secretmanager.secrets.delete", AuthModeAudit},
+		{"resource star stays in segment", "projects/p/x/secrets/legacy", "secretmanager.secrets.delete", AuthModeOff},
+		{"exact permission", "projects/p", "secretmanager.secrets.get", AuthModeStrict},
+		{"no match falls back", "projects/p", "cloudkms.cryptoKeys.encrypt", AuthModeOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overrides.Mode(tt.resource, tt.permission, AuthModeOff); got != tt.want {
+				t.Errorf("Mode(%q, %q) = %v, want %v", tt.resource, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"a.b.c", "a.b.c", true},
+		{"a.b.c", "a.b.cd", false},
+		{"a.*", "a.b.c", true},
+		{"*.c", "a.b.c", true},
+		{"a.*.c", "a.b.b.c", true},
+		{"a.*.c", "a.b.d", false},
+		{"*", "", true},
+		{"**", "anything", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestClient_ModeOverrides(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+
+	recorder := &auditRecorder{}
+	client, err := NewClient(addr, AuthModePermissive,
+		WithModeOverrides(ModeOverrides{
+			{Pattern: "secretmanager.versions.*", Mode: AuthModeStrict},
+			{Pattern: "secretmanager.secrets.delete", Mode: AuthModeAudit},
+		}),
+		WithAuditFunc(recorder.record),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	resource := "projects/test-project/secrets/test-secret"
+
+	tests := []struct {
+		permission  string
+		wantAllowed bool
+		wantReason  DecisionReason
+		wantMode    AuthMode
+		wantErr     bool
+	}{
+		{"secretmanager.secrets.list", true, ReasonFailOpen, AuthModePermissive, false},
+		{"secretmanager.versions.access", false, ReasonFailClosed, AuthModeStrict, true},
+		{"secretmanager.secrets.delete", true, ReasonFailClosed, AuthModeAudit, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			d, err := client.Decide(ctx, "user:test@example.com", resource, tt.permission)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decide() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d.Allowed != tt.wantAllowed || d.Reason != tt.wantReason || d.Mode != tt.wantMode {
+				t.Errorf("Decide() = %v/%v/%v, want %v/%v/%v",
+					d.Allowed, d.Reason, d.Mode, tt.wantAllowed, tt.wantReason, tt.wantMode)
+			}
+		})
+	}
+
+	if got := recorder.get(); len(got) != 1 || got[0].Permission != "secretmanager.secrets.delete" {
+		t.Errorf("audited decisions = %+v, want only the audit override", got)
+	}
+
+	// A batch fails as a whole if any check failed closed
+	_, err = client.CheckPermissions(ctx, "user:test@example.com", resource,
+		[]string{"secretmanager.secrets.list", "secretmanager.versions.access"})
+	if !IsConnectivityError(err) {
+		t.Errorf("CheckPermissions() error = %v, want connectivity error", err)
+	}
+	granted, err := client.CheckPermissions(ctx, "user:test@example.com", resource,
+		[]string{"secretmanager.secrets.list", "secretmanager.secrets.delete"})
+	if err != nil || !granted["secretmanager.secrets.list"] || !granted["secretmanager.secrets.delete"] {
+		t.Errorf("CheckPermissions() = %v, %v, want both allowed", granted, err)
+	}
+}
+
+func TestWithModeOverrides_Invalid(t *testing.T) {
+	_, err := NewClient("localhost:9999", AuthModeStrict, WithModeOverrides(ModeOverrides{{Pattern: "*.list", Mode: AuthModeOff}}))
+	if err == nil {
+		t.Error("NewClient() should reject an off override")
+	}
+}
@@ -0,0 +1,187 @@
+package emulatorauth
+
+import (
+	"fmt"
+	"go/token"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// routePattern is a parsed http.ServeMux-style pattern:
+//
+//	[METHOD ][HOST]/[PATH]
+//
+// Path segments are literals, wildcards ("{name}"), a trailing multi-segment
+// wildcard ("{name...}") or a trailing "{$}" anchor. A pattern ending in "/"
+// matches every path below it. As an extension for Google APIs, a wildcard
+// may carry a custom verb suffix ("{secret}:access").
+type routePattern struct {
+	raw      string
+	method   string
+	host     string
+	segments []patternSegment
+
+	// prefix is set for patterns ending in "/"
+	prefix bool
+
+	// exactSlash is set for patterns ending in "/{$}"
+	exactSlash bool
+}
+
+type patternSegment struct {
+	literal  string
+	wildcard string
+	verb     string
+	multi    bool
+}
+
+func parseRoutePattern(s string) (*routePattern, error) {
+	p := &routePattern{raw: s}
+
+	rest := s
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		p.method = rest[:i]
+		rest = strings.TrimLeft(rest[i+1:], " \t")
+		if p.method == "" || strings.ToUpper(p.method) != p.method {
+			return nil, fmt.Errorf("pattern %q: invalid method %q", s, p.method)
+		}
+	}
+
+	i := strings.Index(rest, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("pattern %q: host/path missing /", s)
+	}
+	p.host, rest = rest[:i], rest[i+1:]
+
+	if rest == "" {
+		p.prefix = true
+		return p, nil
+	}
+
+	parts := strings.Split(rest, "/")
+	seen := make(map[string]bool)
+	for j, part := range parts {
+		last := j == len(parts)-1
+
+		switch {
+		case part == "":
+			if !last {
+				return nil, fmt.Errorf("pattern %q: empty path segment", s)
+			}
+			p.prefix = true
+
+		case part == "{$}":
+			if !last {
+				return nil, fmt.Errorf("pattern %q: {$} not at end", s)
+			}
+			p.exactSlash = true
+
+		case strings.HasPrefix(part, "{"):
+			end := strings.Index(part, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("pattern %q: unterminated wildcard %q", s, part)
+			}
+			seg := patternSegment{wildcard: part[1:end], verb: part[end+1:]}
+			if seg.verb != "" && (!strings.HasPrefix(seg.verb, ":") || strings.ContainsAny(seg.verb, "{}")) {
+				return nil, fmt.Errorf("pattern %q: wildcard %q may only be followed by a :verb", s, part)
+			}
+			if name, ok := strings.CutSuffix(seg.wildcard, "..."); ok {
+				if !last || seg.verb != "" {
+					return nil, fmt.Errorf("pattern %q: %q wildcard not at end", s, part)
+				}
+				seg.wildcard, seg.multi = name, true
+			}
+			if !token.IsIdentifier(seg.wildcard) {
+				return nil, fmt.Errorf("pattern %q: bad wildcard name %q", s, seg.wildcard)
+			}
+			if seen[seg.wildcard] {
+				return nil, fmt.Errorf("pattern %q: duplicate wildcard name %q", s, seg.wildcard)
+			}
+			seen[seg.wildcard] = true
+			p.segments = append(p.segments, seg)
+
+		default:
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("pattern %q: bad wildcard segment %q", s, part)
+			}
+			literal, err := url.PathUnescape(part)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: %w", s, err)
+			}
+			p.segments = append(p.segments, patternSegment{literal: literal})
+		}
+	}
+
+	return p, nil
+}
+
+// match reports whether the request matches the pattern and returns the
+// wildcard values
+func (p *routePattern) match(r *http.Request) (map[string]string, bool) {
+	if p.method != "" && p.method != r.Method && !(p.method == http.MethodGet && r.Method == http.MethodHead) {
+		return nil, false
+	}
+
+	if p.host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host != p.host {
+			return nil, false
+		}
+	}
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	parts := strings.Split(path[1:], "/")
+
+	values := make(map[string]string)
+	for i, seg := range p.segments {
+		// Like ServeMux, "/a/{rest...}" needs the slash after "a": "/a" is no match
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		if seg.multi {
+			value, err := url.PathUnescape(strings.Join(parts[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			values[seg.wildcard] = value
+			return values, true
+		}
+
+		part, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+
+		if seg.wildcard == "" {
+			if part != seg.literal {
+				return nil, false
+			}
+			continue
+		}
+
+		value, ok := strings.CutSuffix(part, seg.verb)
+		if !ok || value == "" {
+			return nil, false
+		}
+		values[seg.wildcard] = value
+	}
+
+	n := len(p.segments)
+	switch {
+	case p.exactSlash:
+		return values, len(parts) == n+1 && parts[n] == ""
+	case p.prefix:
+		return values, len(parts) > n
+	default:
+		return values, len(parts) == n
+	}
+}
@@ -0,0 +1,206 @@
+package emulatorauth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutePattern_Errors(t *testing.T) {
+	patterns := []string{
+		"",
+		"GET",
+		"get /v1/secrets",
+		"/v1//secrets",
+		"/v1/{$}/secrets",
+		"/v1/{name",
+		"/v1/{name}suffix",
+		"/v1/{rest...}/more",
+		"/v1/{rest...}:verb",
+		"/v1/{bad-name}",
+		"/v1/{}",
+		"/v1/{a}/{a}",
+		"/v1/pre{name}",
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := parseRoutePattern(pattern); err == nil {
+				t.Errorf("parseRoutePattern(%q) should return error", pattern)
+			}
+		})
+	}
+}
+
+func TestRoutePatternMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		method     string
+		target     string
+		wantMatch  bool
+		wantValues map[string]string
+	}{
+		{
+			name:       "literal path",
+			pattern:    "/v1/projects",
+			method:     "GET",
+			target:     "/v1/projects",
+			wantMatch:  true,
+			wantValues: map[string]string{},
+		},
+		{
+			name:      "literal path mismatch",
+			pattern:   "/v1/projects",
+			method:    "GET",
+			target:    "/v1/folders",
+			wantMatch: false,
+		},
+		{
+			name:       "wildcards",
+			pattern:    "GET /v1/projects/{project}/secrets/{secret}",
+			method:     "GET",
+			target:     "/v1/projects/p1/secrets/s1",
+			wantMatch:  true,
+			wantValues: map[string]string{"project": "p1", "secret": "s1"},
+		},
+		{
+			name:      "method mismatch",
+			pattern:   "POST /v1/projects/{project}",
+			method:    "GET",
+			target:    "/v1/projects/p1",
+			wantMatch: false,
+		},
+		{
+			name:       "GET matches HEAD",
+			pattern:    "GET /v1/projects/{project}",
+			method:     "HEAD",
+			target:     "/v1/projects/p1",
+			wantMatch:  true,
+			wantValues: map[string]string{"project": "p1"},
+		},
+		{
+			name:       "custom verb",
+			pattern:    "POST /v1/projects/{project}/secrets/{secret}/versions/{version}:access",
+			method:     "POST",
+			target:     "/v1/projects/p1/secrets/s1/versions/latest:access",
+			wantMatch:  true,
+			wantValues: map[string]string{"project": "p1", "secret": "s1", "version": "latest"},
+		},
+		{
+			name:      "custom verb mismatch",
+			pattern:   "POST /v1/projects/{project}/secrets/{secret}:access",
+			method:    "POST",
+			target:    "/v1/projects/p1/secrets/s1:destroy",
+			wantMatch: false,
+		},
+		{
+			name:      "wildcard does not match empty segment",
+			pattern:   "/v1/projects/{project}/secrets",
+			method:    "GET",
+			target:    "/v1/projects//secrets",
+			wantMatch: false,
+		},
+		{
+			name:       "escaped wildcard value",
+			pattern:    "/v1/{name}",
+			method:     "GET",
+			target:     "/v1/a%2Fb",
+			wantMatch:  true,
+			wantValues: map[string]string{"name": "a/b"},
+		},
+		{
+			name:       "multi-segment wildcard",
+			pattern:    "/v1/{name...}",
+			method:     "GET",
+			target:     "/v1/projects/p1/secrets/s1",
+			wantMatch:  true,
+			wantValues: map[string]string{"name": "projects/p1/secrets/s1"},
+		},
+		{
+			name:       "multi-segment wildcard matches empty rest",
+			pattern:    "/v1/{name...}",
+			method:     "GET",
+			target:     "/v1/",
+			wantMatch:  true,
+			wantValues: map[string]string{"name": ""},
+		},
+		{
+			name:      "multi-segment wildcard needs the slash",
+			pattern:   "GET /a/{rest...}",
+			method:    "GET",
+			target:    "/a",
+			wantMatch: false,
+		},
+		{
+			name:       "trailing slash prefix",
+			pattern:    "/v1/",
+			method:     "GET",
+			target:     "/v1/projects/p1",
+			wantMatch:  true,
+			wantValues: map[string]string{},
+		},
+		{
+			name:      "trailing slash needs the slash",
+			pattern:   "/v1/",
+			method:    "GET",
+			target:    "/v1",
+			wantMatch: false,
+		},
+		{
+			name:       "root matches everything",
+			pattern:    "/",
+			method:     "DELETE",
+			target:     "/anything/at/all",
+			wantMatch:  true,
+			wantValues: map[string]string{},
+		},
+		{
+			name:       "exact slash anchor",
+			pattern:    "/v1/{$}",
+			method:     "GET",
+			target:     "/v1/",
+			wantMatch:  true,
+			wantValues: map[string]string{},
+		},
+		{
+			name:      "exact slash anchor rejects deeper paths",
+			pattern:   "/v1/{$}",
+			method:    "GET",
+			target:    "/v1/projects",
+			wantMatch: false,
+		},
+		{
+			name:       "host",
+			pattern:    "secretmanager.local/v1/{name}",
+			method:     "GET",
+			target:     "http://secretmanager.local:8080/v1/s1",
+			wantMatch:  true,
+			wantValues: map[string]string{"name": "s1"},
+		},
+		{
+			name:      "host mismatch",
+			pattern:   "secretmanager.local/v1/{name}",
+			method:    "GET",
+			target:    "http://kms.local/v1/s1",
+			wantMatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseRoutePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("parseRoutePattern(%q) error = %v", tt.pattern, err)
+			}
+
+			values, ok := p.match(httptest.NewRequest(tt.method, tt.target, nil))
+			if ok != tt.wantMatch {
+				t.Fatalf("match(%s %s) = %v, want %v", tt.method, tt.target, ok, tt.wantMatch)
+			}
+			if ok && !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("values = %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
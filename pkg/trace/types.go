@@ -11,6 +11,8 @@ const (
 const (
 	EventTypeAuthzCheck = "authz_check"
 	EventTypeAuthzError = "authz_error"
+	EventTypeAuthzAudit = "authz_audit" // would-be denial allowed by audit mode
+	EventTypeModeChange = "mode_change" // auth mode switched at runtime
 )
 
 // Decision outcomes
@@ -34,6 +36,8 @@ type AuthzEvent struct {
 	Environment *Environment  `json:"environment,omitempty"`
 
 	Error *AuthzError `json:"error,omitempty"`
+
+	ModeChange *ModeChange `json:"mode_change,omitempty"`
 }
 
 type TraceContext struct {
@@ -119,6 +123,11 @@ type AuthzError struct {
 	Retryable bool   `json:"retryable,omitempty"`
 }
 
+type ModeChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 // NowRFC3339Nano returns the current time in ISO-8601 format with nanosecond precision.
 func NowRFC3339Nano() string {
 	return time.Now().UTC().Format(time.RFC3339Nano)
@@ -41,16 +41,9 @@ func NewWriter(dest string) (*Writer, error) {
 		return nil, errors.New("trace destination cannot be empty")
 	}
 
-	var out io.WriteCloser
-
-	if strings.ToLower(dest) == "stdout" {
-		out = os.Stdout
-	} else {
-		f, err := os.OpenFile(dest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open trace file: %w", err)
-		}
-		out = f
+	out, err := openDest(dest)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Writer{
@@ -59,6 +52,57 @@ func NewWriter(dest string) (*Writer, error) {
 	}, nil
 }
 
+func openDest(dest string) (io.WriteCloser, error) {
+	if strings.ToLower(dest) == "stdout" {
+		return os.Stdout, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return f, nil
+}
+
+// Reopen switches the writer to a new destination (same forms as NewWriter).
+// Buffered events are flushed to the old destination, which is then closed.
+// On error the writer keeps its old destination.
+// Thread-safe.
+func (w *Writer) Reopen(dest string) error {
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if dest == "" {
+		return errors.New("trace destination cannot be empty")
+	}
+
+	out, err := openDest(dest)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		if out != os.Stdout {
+			_ = out.Close()
+		}
+		return errors.New("writer is closed")
+	}
+
+	flushErr := w.bw.Flush()
+	var closeErr error
+	if w.out != os.Stdout {
+		closeErr = w.out.Close()
+	}
+
+	w.out = out
+	w.bw = bufio.NewWriter(out)
+
+	return errors.Join(flushErr, closeErr)
+}
+
 // Emit writes an event to the trace output as a single JSON line.
 // Thread-safe. Does not flush automatically (use Flush or defer Close).
 func (w *Writer) Emit(ev AuthzEvent) error {
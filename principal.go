@@ -2,8 +2,13 @@ package emulatorauth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"unicode"
 
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -15,24 +20,39 @@ const (
 	PrincipalHeaderKey = "X-Emulator-Principal"
 )
 
-// ExtractPrincipalFromContext extracts the principal from gRPC incoming metadata
+// ExtractPrincipalFromContext extracts the principal from gRPC incoming
+// metadata: x-emulator-principal if set, otherwise the email claim of a JWT
+// bearer token in the authorization metadata (see DefaultPrincipalExtractor)
 func ExtractPrincipalFromContext(ctx context.Context) string {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return ""
-	}
+	return defaultPrincipalExtractor.ExtractFromContext(ctx)
+}
 
-	principals := md.Get(PrincipalMetadataKey)
-	if len(principals) == 0 {
-		return ""
-	}
+// ExtractPrincipalFromRequest extracts the principal from HTTP request
+// headers: X-Emulator-Principal if set, otherwise the email claim of a JWT
+// bearer token in the Authorization header (see DefaultPrincipalExtractor)
+func ExtractPrincipalFromRequest(r *http.Request) string {
+	return defaultPrincipalExtractor.ExtractFromRequest(r)
+}
 
-	return principals[0]
+// ExtractPrincipalFromContextStrict is ExtractPrincipalFromContext returning
+// a parsed Principal. A missing principal is the zero Principal; a malformed
+// one is an error.
+func ExtractPrincipalFromContextStrict(ctx context.Context) (Principal, error) {
+	return parseExtractedPrincipal(ExtractPrincipalFromContext(ctx))
 }
 
-// ExtractPrincipalFromRequest extracts the principal from HTTP request header
-func ExtractPrincipalFromRequest(r *http.Request) string {
-	return r.Header.Get(PrincipalHeaderKey)
+// ExtractPrincipalFromRequestStrict is ExtractPrincipalFromRequest returning
+// a parsed Principal. A missing principal is the zero Principal; a malformed
+// one is an error.
+func ExtractPrincipalFromRequestStrict(r *http.Request) (Principal, error) {
+	return parseExtractedPrincipal(ExtractPrincipalFromRequest(r))
+}
+
+func parseExtractedPrincipal(s string) (Principal, error) {
+	if s == "" {
+		return Principal{}, nil
+	}
+	return ParsePrincipal(s)
 }
 
 // InjectPrincipalToContext adds the principal to outgoing gRPC metadata
@@ -42,3 +62,143 @@ func InjectPrincipalToContext(ctx context.Context, principal string) context.Con
 	}
 	return metadata.AppendToOutgoingContext(ctx, PrincipalMetadataKey, principal)
 }
+
+// PrincipalType is the kind of IAM member a Principal identifies
+type PrincipalType string
+
+const (
+	PrincipalTypeUser                  PrincipalType = "user"
+	PrincipalTypeServiceAccount        PrincipalType = "serviceAccount"
+	PrincipalTypeGroup                 PrincipalType = "group"
+	PrincipalTypeDomain                PrincipalType = "domain"
+	PrincipalTypeAllUsers              PrincipalType = "allUsers"
+	PrincipalTypeAllAuthenticatedUsers PrincipalType = "allAuthenticatedUsers"
+
+	// PrincipalTypePrincipal is a single workload or workforce identity
+	// (principal://iam.googleapis.com/...)
+	PrincipalTypePrincipal PrincipalType = "principal"
+
+	// PrincipalTypePrincipalSet is a set of workload or workforce identities
+	// (principalSet://iam.googleapis.com/...)
+	PrincipalTypePrincipalSet PrincipalType = "principalSet"
+)
+
+// memberTypes are the PrincipalTypes written as "type:id"
+var memberTypes = []PrincipalType{
+	PrincipalTypeUser,
+	PrincipalTypeServiceAccount,
+	PrincipalTypeGroup,
+	PrincipalTypeDomain,
+}
+
+// Principal is a parsed IAM member
+type Principal struct {
+	Type PrincipalType
+
+	// ID is the email (user, serviceAccount, group), the domain, or the
+	// identity pool path after "principal://" or "principalSet://"; empty
+	// for allUsers and allAuthenticatedUsers
+	ID string
+}
+
+// ParsePrincipal parses an IAM member such as "user:alice@example.com",
+// "serviceAccount:app@test-project.iam.gserviceaccount.com", "allUsers" or
+// "principal://iam.googleapis.com/projects/123/locations/global/...". Type
+// prefixes are case-sensitive, as in IAM policies, so "serviceaccount:..."
+// and bare emails are errors rather than principals that are always denied.
+func ParsePrincipal(s string) (Principal, error) {
+	switch PrincipalType(s) {
+	case "":
+		return Principal{}, errors.New("empty principal")
+	case PrincipalTypeAllUsers, PrincipalTypeAllAuthenticatedUsers:
+		return Principal{Type: PrincipalType(s)}, nil
+	}
+
+	for _, typ := range []PrincipalType{PrincipalTypePrincipal, PrincipalTypePrincipalSet} {
+		if id, ok := strings.CutPrefix(s, string(typ)+"://"); ok {
+			host, path, _ := strings.Cut(id, "/")
+			if host == "" || path == "" || hasSpaceOrControl(id) {
+				return Principal{}, fmt.Errorf("invalid %s principal %q (want %s://iam.googleapis.com/...)", typ, s, typ)
+			}
+			return Principal{Type: typ, ID: id}, nil
+		}
+	}
+
+	prefix, id, ok := strings.Cut(s, ":")
+	if !ok {
+		if isEmail(s) {
+			return Principal{}, fmt.Errorf("principal %q has no type (want user:%s or serviceAccount:%s)", s, s, s)
+		}
+		return Principal{}, fmt.Errorf("invalid principal %q (want type:id, allUsers, allAuthenticatedUsers or a principal:// URI)", s)
+	}
+
+	typ := PrincipalType(prefix)
+	if !typ.isMember() {
+		for _, known := range memberTypes {
+			if strings.EqualFold(prefix, string(known)) {
+				return Principal{}, fmt.Errorf("unknown principal type %q in %q (did you mean %s?)", prefix, s, known)
+			}
+		}
+		return Principal{}, fmt.Errorf("unknown principal type %q in %q (want user, serviceAccount, group or domain)", prefix, s)
+	}
+
+	if typ == PrincipalTypeDomain {
+		if id == "" || strings.Contains(id, "@") || hasSpaceOrControl(id) {
+			return Principal{}, fmt.Errorf("invalid domain in principal %q", s)
+		}
+	} else if !isEmail(id) {
+		return Principal{}, fmt.Errorf("invalid email in principal %q", s)
+	}
+
+	return Principal{Type: typ, ID: id}, nil
+}
+
+func (t PrincipalType) isMember() bool {
+	for _, known := range memberTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmail reports whether s looks like local@domain
+func isEmail(s string) bool {
+	local, domain, ok := strings.Cut(s, "@")
+	return ok && local != "" && domain != "" && !strings.Contains(domain, "@") && !hasSpaceOrControl(s)
+}
+
+// hasSpaceOrControl reports whether s contains whitespace or a control
+// character, e.g. a trailing newline from a file or header
+func hasSpaceOrControl(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) >= 0
+}
+
+// String returns the principal in IAM member form, as sent to the emulator
+func (p Principal) String() string {
+	switch p.Type {
+	case "":
+		return ""
+	case PrincipalTypeAllUsers, PrincipalTypeAllAuthenticatedUsers:
+		return string(p.Type)
+	case PrincipalTypePrincipal, PrincipalTypePrincipalSet:
+		return string(p.Type) + "://" + p.ID
+	default:
+		return string(p.Type) + ":" + p.ID
+	}
+}
+
+// IsZero reports whether p is the zero Principal, e.g. no principal found
+func (p Principal) IsZero() bool {
+	return p == Principal{}
+}
+
+// TraceActor returns the principal as a pkg/trace actor
+func (p Principal) TraceActor() *trace.Actor {
+	return &trace.Actor{
+		Principal:     p.String(),
+		PrincipalType: string(p.Type),
+	}
+}
@@ -3,6 +3,7 @@ package emulatorauth
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"google.golang.org/grpc/metadata"
@@ -213,3 +214,106 @@ func TestInjectPrincipalToContext_Append(t *testing.T) {
 		t.Errorf("Principal = %q, want %q", md.Get(PrincipalMetadataKey)[0], "user:alice@example.com")
 	}
 }
+
+func TestParsePrincipal(t *testing.T) {
+	const workload = "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/subject/runner"
+
+	tests := []struct {
+		input   string
+		want    Principal
+		wantErr string
+	}{
+		{input: "user:alice@example.com", want: Principal{Type: PrincipalTypeUser, ID: "alice@example.com"}},
+		{input: "serviceAccount:app@test-project.iam.gserviceaccount.com", want: Principal{Type: PrincipalTypeServiceAccount, ID: "app@test-project.iam.gserviceaccount.com"}},
+		{input: "group:admins@example.com", want: Principal{Type: PrincipalTypeGroup, ID: "admins@example.com"}},
+		{input: "domain:example.com", want: Principal{Type: PrincipalTypeDomain, ID: "example.com"}},
+		{input: "allUsers", want: Principal{Type: PrincipalTypeAllUsers}},
+		{input: "allAuthenticatedUsers", want: Principal{Type: PrincipalTypeAllAuthenticatedUsers}},
+		{input: "principal://" + workload, want: Principal{Type: PrincipalTypePrincipal, ID: workload}},
+		{input: "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/*", want: Principal{Type: PrincipalTypePrincipalSet, ID: "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/*"}},
+		{input: "", wantErr: "empty principal"},
+		{input: "alice@example.com", wantErr: "has no type"},
+		{input: "serviceaccount:app@test-project.iam.gserviceaccount.com", wantErr: "did you mean serviceAccount"},
+		{input: "allusers", wantErr: "invalid principal"},
+		{input: "robot:alice@example.com", wantErr: "unknown principal type"},
+		{input: "user:alice", wantErr: "invalid email"},
+		{input: "user:", wantErr: "invalid email"},
+		{input: "user:a@b.c\n", wantErr: "invalid email"},
+		{input: "user:alice\u00a0@example.com", wantErr: "invalid email"},
+		{input: "serviceAccount:app@test-project.iam.gserviceaccount.com\x00", wantErr: "invalid email"},
+		{input: "domain:example.com\r", wantErr: "invalid domain"},
+		{input: "principal://iam.googleapis.com/projects/123\n", wantErr: "invalid principal principal"},
+		{input: "domain:alice@example.com", wantErr: "invalid domain"},
+		{input: "principal://", wantErr: "invalid principal principal"},
+		{input: "principal://iam.googleapis.com", wantErr: "invalid principal principal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePrincipal(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePrincipal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrincipal() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePrincipal() = %+v, want %+v", got, tt.want)
+			}
+			// Round-trips to the IAM member form
+			if got.String() != tt.input {
+				t.Errorf("String() = %q, want %q", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestPrincipal_TraceActor(t *testing.T) {
+	p, err := ParsePrincipal("serviceAccount:ci@test-project.iam.gserviceaccount.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actor := p.TraceActor()
+	if actor.Principal != "serviceAccount:ci@test-project.iam.gserviceaccount.com" || actor.PrincipalType != "serviceAccount" {
+		t.Errorf("TraceActor() = %+v", actor)
+	}
+
+	// Decisions for unparseable principals keep the raw string
+	actor = Decision{Principal: "alice"}.TraceActor()
+	if actor.Principal != "alice" || actor.PrincipalType != "" {
+		t.Errorf("Decision.TraceActor() = %+v, want raw principal without type", actor)
+	}
+}
+
+func TestExtractPrincipalStrict(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		want      Principal
+		wantErr   bool
+	}{
+		{name: "valid", principal: "user:alice@example.com", want: Principal{Type: PrincipalTypeUser, ID: "alice@example.com"}},
+		{name: "missing", principal: "", want: Principal{}},
+		{name: "malformed", principal: "alice@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PrincipalMetadataKey, tt.principal))
+			got, err := ExtractPrincipalFromContextStrict(ctx)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ExtractPrincipalFromContextStrict() = %+v, %v; want %+v, error %v", got, err, tt.want, tt.wantErr)
+			}
+
+			req := &http.Request{Header: http.Header{PrincipalHeaderKey: []string{tt.principal}}}
+			got, err = ExtractPrincipalFromRequestStrict(req)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ExtractPrincipalFromRequestStrict() = %+v, %v; want %+v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package emulatorauth
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// PrincipalTransport is an http.RoundTripper that sends X-Emulator-Principal
+// on every request, so a whole HTTP client (e.g. through
+// option.WithHTTPClient) acts as one principal. A principal set on the
+// request context with InjectPrincipalToContext takes precedence over
+// Principal, and a header already set on the request over both.
+type PrincipalTransport struct {
+	// Principal is sent when the request context carries none
+	Principal string
+
+	// Base performs the requests (http.DefaultTransport if nil)
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *PrincipalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	principal := outgoingPrincipal(req.Context())
+	if principal == "" {
+		principal = t.Principal
+	}
+	if principal == "" || req.Header.Get(PrincipalHeaderKey) != "" {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(PrincipalHeaderKey, principal)
+	return base.RoundTrip(req)
+}
+
+// PrincipalCredentials returns per-RPC credentials that send principal as
+// x-emulator-principal on every call of a gRPC connection, e.g. through
+// option.WithGRPCDialOption(grpc.WithPerRPCCredentials(...)). Calls whose
+// context already carries a principal from InjectPrincipalToContext keep it.
+// The credentials don't require transport security, since emulators usually
+// serve plaintext.
+func PrincipalCredentials(principal string) credentials.PerRPCCredentials {
+	return principalCredentials(principal)
+}
+
+type principalCredentials string
+
+func (c principalCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	if c == "" || outgoingPrincipal(ctx) != "" {
+		return nil, nil
+	}
+	return map[string]string{PrincipalMetadataKey: string(c)}, nil
+}
+
+func (principalCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// PrincipalUnaryClientInterceptor injects principal into the outgoing
+// metadata of unary calls that don't already carry one
+func PrincipalUnaryClientInterceptor(principal string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withOutgoingPrincipal(ctx, principal), method, req, reply, cc, opts...)
+	}
+}
+
+// PrincipalStreamClientInterceptor injects principal into the outgoing
+// metadata of streaming calls that don't already carry one
+func PrincipalStreamClientInterceptor(principal string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOutgoingPrincipal(ctx, principal), desc, cc, method, opts...)
+	}
+}
+
+func withOutgoingPrincipal(ctx context.Context, principal string) context.Context {
+	if outgoingPrincipal(ctx) != "" {
+		return ctx
+	}
+	return InjectPrincipalToContext(ctx, principal)
+}
+
+// outgoingPrincipal returns the principal set with InjectPrincipalToContext,
+// or ""
+func outgoingPrincipal(ctx context.Context) string {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	principals := md.Get(PrincipalMetadataKey)
+	if len(principals) == 0 {
+		return ""
+	}
+	return principals[0]
+}
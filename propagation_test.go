@@ -0,0 +1,125 @@
+package emulatorauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestPrincipalTransport(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ExtractPrincipalFromRequest(r)
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: &PrincipalTransport{Principal: "user:alice@example.com"}}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		want   string
+	}{
+		{name: "client principal", ctx: context.Background(), want: "user:alice@example.com"},
+		{name: "context principal wins", ctx: InjectPrincipalToContext(context.Background(), "user:bob@example.com"), want: "user:bob@example.com"},
+		{name: "explicit header wins", ctx: context.Background(), header: "user:carol@example.com", want: "user:carol@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req, err := http.NewRequestWithContext(tt.ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(PrincipalHeaderKey, tt.header)
+			}
+
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got != tt.want {
+				t.Errorf("server saw principal %q, want %q", got, tt.want)
+			}
+			// The caller's request is left untouched
+			if tt.header == "" && req.Header.Get(PrincipalHeaderKey) != "" {
+				t.Error("RoundTrip modified the caller's request")
+			}
+		})
+	}
+}
+
+func TestPrincipalPropagation_GRPC(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+
+	var got string
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		got = ExtractPrincipalFromContext(ctx)
+		return &iampb.TestIamPermissionsResponse{}, nil
+	})
+
+	tests := []struct {
+		name string
+		opt  grpc.DialOption
+	}{
+		{name: "per-RPC credentials", opt: grpc.WithPerRPCCredentials(PrincipalCredentials("user:alice@example.com"))},
+		{name: "unary interceptor", opt: grpc.WithUnaryInterceptor(PrincipalUnaryClientInterceptor("user:alice@example.com"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), tt.opt)
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer conn.Close()
+			iam := iampb.NewIAMPolicyClient(conn)
+
+			for _, c := range []struct {
+				ctx  context.Context
+				want string
+			}{
+				{ctx: context.Background(), want: "user:alice@example.com"},
+				{ctx: InjectPrincipalToContext(context.Background(), "user:bob@example.com"), want: "user:bob@example.com"},
+			} {
+				got = ""
+				if _, err := iam.TestIamPermissions(c.ctx, &iampb.TestIamPermissionsRequest{Resource: "projects/test-project"}); err != nil {
+					t.Fatalf("TestIamPermissions() error = %v", err)
+				}
+				if got != c.want {
+					t.Errorf("server saw principal %q, want %q", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrincipalStreamClientInterceptor(t *testing.T) {
+	interceptor := PrincipalStreamClientInterceptor("user:alice@example.com")
+
+	var got string
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		got = outgoingPrincipal(ctx)
+		return nil, nil
+	}
+
+	_, _ = interceptor(context.Background(), &grpc.StreamDesc{}, nil, testMethod, streamer)
+	if got != "user:alice@example.com" {
+		t.Errorf("stream principal = %q, want user:alice@example.com", got)
+	}
+
+	_, _ = interceptor(InjectPrincipalToContext(context.Background(), "user:bob@example.com"), &grpc.StreamDesc{}, nil, testMethod, streamer)
+	if got != "user:bob@example.com" {
+		t.Errorf("stream principal = %q, want the context's user:bob@example.com", got)
+	}
+}
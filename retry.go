@@ -0,0 +1,115 @@
+package emulatorauth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy configures retries of transient IAM errors (those the client's
+// ErrorPolicy resolves with ErrorActionFailMode, by default the ones
+// IsConnectivityError reports). Config errors are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Zero or one disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff time.Duration
+
+	// Multiplier grows the backoff after each attempt
+	Multiplier float64
+
+	// Jitter randomly shortens each backoff by up to this fraction (0-1)
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns a policy suited to an IAM emulator container
+// that is still starting up
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// WithRetry retries connectivity errors with exponential backoff and jitter.
+// Each attempt gets the client timeout, and retries stop once the caller's
+// context is done or its deadline leaves no room for the next backoff.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retry = policy
+	}
+}
+
+// IsEnabled returns true if the policy allows more than one attempt
+func (p RetryPolicy) IsEnabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func (p RetryPolicy) validate() error {
+	if !p.IsEnabled() {
+		return nil
+	}
+	if p.InitialBackoff <= 0 {
+		return errors.New("retry initial backoff must be positive")
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		return errors.New("retry max backoff must not be less than initial backoff")
+	}
+	if p.Multiplier < 1 {
+		return errors.New("retry multiplier must be at least 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("retry jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// backoff returns the wait before the given retry (1 for the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// retry runs call until it succeeds, fails with an error transient rejects,
+// runs out of attempts or the context is done. It returns the last error and
+// the number of attempts made.
+func (p RetryPolicy) retry(ctx context.Context, transient func(error) bool, call func() error) (int, error) {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = call()
+		if err == nil || !transient(err) || attempt >= attempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		wait := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package emulatorauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fastRetry retries quickly so tests don't wait on real backoff
+func fastRetry(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{"disabled zero value", RetryPolicy{}, false},
+		{"single attempt ignores other fields", RetryPolicy{MaxAttempts: 1, Multiplier: -1}, false},
+		{"default", DefaultRetryPolicy(), false},
+		{"zero backoff", RetryPolicy{MaxAttempts: 3, MaxBackoff: time.Second, Multiplier: 2}, true},
+		{"max below initial", RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Millisecond, Multiplier: 2}, true},
+		{"shrinking multiplier", RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, Multiplier: 0.5}, true},
+		{"jitter above one", RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, Multiplier: 2, Jitter: 1.5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second, // capped
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := policy.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(1)
+		if got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter = %v, want within [50ms, 100ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "starting up")
+	invalid := status.Error(codes.InvalidArgument, "bad resource")
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		errs         []error
+		wantAttempts int
+		wantCode     codes.Code
+	}{
+		{"disabled", RetryPolicy{}, []error{unavailable, nil}, 1, codes.Unavailable},
+		{"succeeds after transient errors", fastRetry(3), []error{unavailable, unavailable, nil}, 3, codes.OK},
+		{"gives up after max attempts", fastRetry(3), []error{unavailable, unavailable, unavailable, nil}, 3, codes.Unavailable},
+		{"config errors are not retried", fastRetry(3), []error{invalid, nil}, 1, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			attempts, err := tt.policy.retry(context.Background(), IsConnectivityError, func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d (calls %d), want %d", attempts, calls, tt.wantAttempts)
+			}
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("err = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetry_ContextDeadline(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second,
+		Multiplier:     1,
+	}
+
+	// The deadline leaves no room for a one second backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	attempts, err := policy.retry(ctx, IsConnectivityError, func() error {
+		return status.Error(codes.Unavailable, "down")
+	})
+
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	if !IsConnectivityError(err) {
+		t.Errorf("err = %v, want connectivity error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("retry waited %v despite the caller deadline", elapsed)
+	}
+}
+
+func TestClient_RetryStrictMode(t *testing.T) {
+	fake, addr := startFakeIAMServer(t)
+	fake.SetHandler(func(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+		// The first two calls see an emulator that is still starting
+		if fake.Calls() <= 2 {
+			return nil, status.Error(codes.Unavailable, "starting up")
+		}
+		return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+	})
+
+	client, err := NewClient(addr, AuthModeStrict, WithRetry(fastRetry(5)))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	decision, err := client.Decide(
+		context.Background(),
+		"user:test@example.com",
+		"projects/test-project/secrets/test-secret",
+		"secretmanager.secrets.get",
+	)
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if !decision.Allowed || decision.Reason != ReasonGranted {
+		t.Errorf("Decide() = %+v, want granted", decision)
+	}
+	if decision.Attempts != 3 || fake.Calls() != 3 {
+		t.Errorf("Attempts = %d (server calls %d), want 3", decision.Attempts, fake.Calls())
+	}
+}
+
+func TestClient_RetryConfigErrorNotRetried(t *testing.T) {
+	client, err := NewClient(iamEmulatorHost, AuthModeStrict, WithRetry(fastRetry(5)))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	// Empty resource is rejected by the emulator as a config error
+	decision, err := client.Decide(context.Background(), "user:test@example.com", "", "secretmanager.secrets.get")
+	if err == nil {
+		t.Skip("IAM emulator accepts empty resource, cannot test config error path")
+	}
+	if decision.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1 (config errors must not be retried)", decision.Attempts)
+	}
+}
+
+func TestNewClient_InvalidRetry(t *testing.T) {
+	_, err := NewClient(iamEmulatorHost, AuthModeStrict, WithRetry(RetryPolicy{MaxAttempts: 3}))
+	if err == nil {
+		t.Error("NewClient(WithRetry) with zero backoff should return error")
+	}
+}
@@ -0,0 +1,83 @@
+package emulatorauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig configures TLS or mTLS for the IAM emulator connection.
+// The zero value means plaintext.
+type TLSConfig struct {
+	// Enabled turns on TLS with the system roots. Setting any other field
+	// also enables TLS.
+	Enabled bool
+
+	// CAFile is a PEM bundle used to verify the IAM emulator certificate
+	// (system roots if empty)
+	CAFile string
+
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS.
+	// Both or neither must be set.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name used to verify the server certificate,
+	// e.g. when dialing a proxy by IP
+	ServerName string
+}
+
+// IsEnabled returns true if the connection should use TLS
+func (t TLSConfig) IsEnabled() bool {
+	return t.Enabled ||
+		t.CAFile != "" ||
+		t.CertFile != "" ||
+		t.KeyFile != "" ||
+		t.ServerName != ""
+}
+
+// TransportCredentials builds gRPC transport credentials from the config
+func (t TLSConfig) TransportCredentials() (credentials.TransportCredentials, error) {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("TLS client certificate and key must be set together")
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA bundle %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// WithTLS connects to the IAM emulator over TLS (or mTLS if a client
+// certificate is set). It replaces any earlier WithTransportCredentials.
+func WithTLS(cfg TLSConfig) Option {
+	return func(o *clientOptions) {
+		o.tls = &cfg
+	}
+}
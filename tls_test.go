@@ -0,0 +1,271 @@
+package emulatorauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// testPKI is a throwaway CA with a server and client certificate written to disk
+type testPKI struct {
+	caFile, serverCertFile, serverKeyFile, clientCertFile, clientKeyFile string
+
+	caPool *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	pki := &testPKI{
+		caFile: writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER),
+		caPool: x509.NewCertPool(),
+	}
+	pki.caPool.AddCert(caCert)
+
+	issue := func(name string, serial int64, template *x509.Certificate) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key: %v", name, err)
+		}
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to create %s certificate: %v", name, err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s key: %v", name, err)
+		}
+		return writePEM(t, dir, name+".pem", "CERTIFICATE", der),
+			writePEM(t, dir, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+
+	pki.serverCertFile, pki.serverKeyFile = issue("server", 2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "iam-emulator"},
+		DNSNames:    []string{"iam-emulator.local"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.clientCertFile, pki.clientKeyFile = issue("client", 3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "secret-manager-emulator"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	return pki
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// serverCreds returns TLS server credentials, requiring a client certificate
+// signed by the test CA if mutual is set
+func (p *testPKI) serverCreds(t *testing.T, mutual bool) credentials.TransportCredentials {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(p.serverCertFile, p.serverKeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load server certificate: %v", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if mutual {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = p.caPool
+	}
+	return credentials.NewTLS(cfg)
+}
+
+func TestTLSConfigIsEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      TLSConfig
+		expected bool
+	}{
+		{"zero value", TLSConfig{}, false},
+		{"explicit", TLSConfig{Enabled: true}, true},
+		{"ca only", TLSConfig{CAFile: "ca.pem"}, true},
+		{"client cert", TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}, true},
+		{"server name only", TLSConfig{ServerName: "iam.local"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.IsEnabled(); got != tt.expected {
+				t.Errorf("IsEnabled() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTLSConfigTransportCredentials_Errors(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+	}{
+		{"missing CA file", TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", TLSConfig{CAFile: pki.clientKeyFile}},
+		{"cert without key", TLSConfig{CertFile: pki.clientCertFile}},
+		{"key without cert", TLSConfig{KeyFile: pki.clientKeyFile}},
+		{"mismatched key pair", TLSConfig{CertFile: pki.clientCertFile, KeyFile: pki.serverKeyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.TransportCredentials(); err == nil {
+				t.Error("TransportCredentials() should return error")
+			}
+			if _, err := NewClient("localhost:9999", AuthModeStrict, WithTLS(tt.cfg)); err == nil {
+				t.Error("NewClient(WithTLS) should return error")
+			}
+		})
+	}
+}
+
+func TestNewClient_TLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name        string
+		mutual      bool
+		cfg         TLSConfig
+		wantConnErr bool
+	}{
+		{
+			name:   "server TLS with CA",
+			mutual: false,
+			cfg:    TLSConfig{CAFile: pki.caFile},
+		},
+		{
+			name:   "mTLS with client certificate",
+			mutual: true,
+			cfg:    TLSConfig{CAFile: pki.caFile, CertFile: pki.clientCertFile, KeyFile: pki.clientKeyFile},
+		},
+		{
+			name:   "server name override",
+			mutual: false,
+			cfg:    TLSConfig{CAFile: pki.caFile, ServerName: "iam-emulator.local"},
+		},
+		{
+			name:        "wrong server name",
+			mutual:      false,
+			cfg:         TLSConfig{CAFile: pki.caFile, ServerName: "other.local"},
+			wantConnErr: true,
+		},
+		{
+			name:        "untrusted server",
+			mutual:      false,
+			cfg:         TLSConfig{Enabled: true},
+			wantConnErr: true,
+		},
+		{
+			name:        "mTLS without client certificate",
+			mutual:      true,
+			cfg:         TLSConfig{CAFile: pki.caFile},
+			wantConnErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, addr := startFakeIAMServer(t, grpc.Creds(pki.serverCreds(t, tt.mutual)))
+
+			client, err := NewClient(addr, AuthModeStrict,
+				WithTLS(tt.cfg),
+				WithTimeout(time.Second),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			allowed, err := client.CheckPermission(
+				context.Background(),
+				"user:test@example.com",
+				"projects/test-project/secrets/test-secret",
+				"secretmanager.secrets.get",
+			)
+
+			if tt.wantConnErr {
+				if !IsConnectivityError(err) {
+					t.Errorf("Expected connectivity error, got allowed=%v err=%v", allowed, err)
+				}
+				return
+			}
+			if err != nil || !allowed {
+				t.Errorf("CheckPermission() = %v, %v; want true, nil", allowed, err)
+			}
+		})
+	}
+}
+
+func TestNewClientFromConfig_TLS(t *testing.T) {
+	pki := newTestPKI(t)
+	_, addr := startFakeIAMServer(t, grpc.Creds(pki.serverCreds(t, true)))
+
+	client, err := NewClientFromConfig(Config{
+		Mode: AuthModeStrict,
+		Host: addr,
+		TLS: TLSConfig{
+			CAFile:   pki.caFile,
+			CertFile: pki.clientCertFile,
+			KeyFile:  pki.clientKeyFile,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClientFromConfig() error = %v", err)
+	}
+	defer client.Close()
+
+	allowed, err := client.CheckPermission(
+		context.Background(),
+		"user:test@example.com",
+		"projects/test-project/secrets/test-secret",
+		"secretmanager.secrets.get",
+	)
+	if err != nil || !allowed {
+		t.Errorf("CheckPermission() = %v, %v; want true, nil", allowed, err)
+	}
+}
@@ -0,0 +1,258 @@
+package emulatorauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+// DefaultPollInterval is how often a ConfigWatcher checks its file for
+// changes when WithPollInterval is not given
+const DefaultPollInterval = time.Second
+
+// ConfigChangeFunc is called after a ConfigWatcher applies a changed
+// configuration
+type ConfigChangeFunc func(old, new Config)
+
+// WatchOption configures a ConfigWatcher
+type WatchOption func(*ConfigWatcher)
+
+// WithWatchClient applies mode and timeout changes to c
+func WithWatchClient(c *Client) WatchOption {
+	return func(w *ConfigWatcher) {
+		w.client = c
+	}
+}
+
+// WithWatchTrace switches tw to the new TraceOutput when it changes
+func WithWatchTrace(tw *trace.Writer) WatchOption {
+	return func(w *ConfigWatcher) {
+		w.traceWriter = tw
+	}
+}
+
+// WithPollInterval sets how often Run checks the file for changes
+// (DefaultPollInterval by default); zero disables polling
+func WithPollInterval(interval time.Duration) WatchOption {
+	return func(w *ConfigWatcher) {
+		w.interval = interval
+	}
+}
+
+// WithReloadSignals sets the signals that make Run reload (SIGHUP by
+// default); none disables signal handling
+func WithReloadSignals(sigs ...os.Signal) WatchOption {
+	return func(w *ConfigWatcher) {
+		w.signals = sigs
+	}
+}
+
+// WithReloadErrorFunc reports reloads failed by Run to fn. The previous
+// configuration stays in effect after a failed reload.
+func WithReloadErrorFunc(fn func(error)) WatchOption {
+	return func(w *ConfigWatcher) {
+		w.onError = fn
+	}
+}
+
+// ConfigWatcher re-reads a config file when it changes or on SIGHUP, so an
+// emulator can follow configuration rewritten between test phases without
+// restarting. Mode and timeout changes are applied to the WithWatchClient
+// client and TraceOutput changes to the WithWatchTrace writer; settings that
+// need a new connection (host, TLS, retry, cache) are only reported to
+// subscribers.
+type ConfigWatcher struct {
+	path        string
+	load        func(path string) (Config, error)
+	client      *Client
+	traceWriter *trace.Writer
+	interval    time.Duration
+	signals     []os.Signal
+	onError     func(error)
+
+	mu     sync.Mutex // serializes reloads; guards cfg and digest
+	cfg    Config
+	digest [sha256.Size]byte
+
+	subsMu sync.Mutex
+	subs   map[int]ConfigChangeFunc
+	nextID int
+}
+
+// NewConfigWatcher loads the config at path, read with LoadFromEnvFile for
+// ".env" files and LoadFromFile otherwise. The initial configuration is not
+// applied; create the client from Config and pass it to WithWatchClient.
+func NewConfigWatcher(path string, opts ...WatchOption) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		path:     path,
+		load:     LoadFromFile,
+		interval: DefaultPollInterval,
+		signals:  []os.Signal{syscall.SIGHUP},
+		subs:     make(map[int]ConfigChangeFunc),
+	}
+	if filepath.Ext(path) == ".env" {
+		w.load = LoadFromEnvFile
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		w.digest = sha256.Sum256(data)
+	}
+	cfg, err := w.load(path)
+	if err != nil {
+		return nil, err
+	}
+	w.cfg = cfg
+
+	return w, nil
+}
+
+// Config returns the configuration currently in effect
+func (w *ConfigWatcher) Config() Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cfg
+}
+
+// Subscribe calls fn after every reload that changes the configuration,
+// until the returned function is called
+func (w *ConfigWatcher) Subscribe(fn ConfigChangeFunc) (unsubscribe func()) {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subs[id] = fn
+
+	return func() {
+		w.subsMu.Lock()
+		defer w.subsMu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Reload re-reads the config file and applies any changes. An invalid file
+// is returned as an error and leaves the previous configuration in effect.
+// Settings are compared with the previous file, so a mode switched at
+// runtime with SetMode is kept until the file changes it.
+func (w *ConfigWatcher) Reload() error {
+	w.mu.Lock()
+
+	if data, err := os.ReadFile(w.path); err == nil {
+		w.digest = sha256.Sum256(data)
+	}
+	cfg, err := w.load(w.path)
+	if err != nil {
+		w.mu.Unlock()
+		return err
+	}
+
+	old := w.cfg
+	if reflect.DeepEqual(old, cfg) {
+		w.mu.Unlock()
+		return nil
+	}
+	w.cfg = cfg
+	w.mu.Unlock()
+
+	// Applied outside the lock: SetMode runs the client's mode change
+	// callbacks, which may call Config or Reload
+	err = w.apply(old, cfg)
+	w.notify(old, cfg)
+	return err
+}
+
+func (w *ConfigWatcher) apply(old, cfg Config) error {
+	var errs []error
+
+	if w.client != nil {
+		if cfg.Mode != old.Mode {
+			errs = append(errs, w.client.SetMode(cfg.Mode))
+		}
+		if cfg.Timeout != old.Timeout {
+			timeout := cfg.Timeout
+			if timeout == 0 {
+				timeout = DefaultTimeout
+			}
+			errs = append(errs, w.client.SetTimeout(timeout))
+		}
+	}
+
+	// Tracing can't be switched off on a live writer; keep the old output
+	if w.traceWriter != nil && cfg.TraceOutput != old.TraceOutput && cfg.TraceOutput != "" {
+		errs = append(errs, w.traceWriter.Reopen(cfg.TraceOutput))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *ConfigWatcher) notify(old, cfg Config) {
+	w.subsMu.Lock()
+	subs := make([]ConfigChangeFunc, 0, len(w.subs))
+	for _, fn := range w.subs {
+		subs = append(subs, fn)
+	}
+	w.subsMu.Unlock()
+
+	for _, fn := range subs {
+		fn(old, cfg)
+	}
+}
+
+// changed reports whether the file content differs from the last reload.
+// An unreadable file, e.g. mid-rewrite, is not a change.
+func (w *ConfigWatcher) changed() bool {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return sha256.Sum256(data) != w.digest
+}
+
+// Run reloads the configuration on the reload signals and whenever the file
+// content changes, until ctx is done
+func (w *ConfigWatcher) Run(ctx context.Context) error {
+	var sigs chan os.Signal
+	if len(w.signals) > 0 {
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, w.signals...)
+		defer signal.Stop(sigs)
+	}
+
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sigs:
+		case <-tick:
+			if !w.changed() {
+				continue
+			}
+		}
+
+		if err := w.Reload(); err != nil && w.onError != nil {
+			w.onError(err)
+		}
+	}
+}
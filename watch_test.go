@@ -0,0 +1,222 @@
+package emulatorauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+// replaceFile rewrites path atomically, as a control plane should, so the
+// watcher never polls a half-written file
+func replaceFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigWatcher_Reload(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	_, addr := startFakeIAMServer(t)
+	dir := t.TempDir()
+	firstTrace := filepath.Join(dir, "first.jsonl")
+	secondTrace := filepath.Join(dir, "second.jsonl")
+
+	path := writeConfigFile(t, "iam.yaml", "mode: strict\nhost: "+addr+"\ntrace_output: "+firstTrace+"\n")
+	tw, err := trace.NewWriter(firstTrace)
+	if err != nil {
+		t.Fatalf("Failed to create trace writer: %v", err)
+	}
+	defer tw.Close()
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	client, err := NewClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	w, err := NewConfigWatcher(path, WithWatchClient(client), WithWatchTrace(tw))
+	if err != nil {
+		t.Fatalf("NewConfigWatcher() error = %v", err)
+	}
+
+	var changes []Config
+	unsubscribe := w.Subscribe(func(old, new Config) {
+		if old.Mode != AuthModeStrict {
+			t.Errorf("old.Mode = %v, want strict", old.Mode)
+		}
+		changes = append(changes, new)
+	})
+
+	// Unchanged content is not reported
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("got %d changes for an unchanged file", len(changes))
+	}
+
+	content := "mode: permissive\nhost: " + addr + "\ntimeout: 5s\ntrace_output: " + secondTrace + "\n"
+	replaceFile(t, path, content)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if len(changes) != 1 || changes[0].Mode != AuthModePermissive {
+		t.Fatalf("changes = %+v, want one change to permissive", changes)
+	}
+	if client.Mode() != AuthModePermissive {
+		t.Errorf("client.Mode() = %v, want permissive", client.Mode())
+	}
+	if client.Timeout() != 5*time.Second {
+		t.Errorf("client.Timeout() = %v, want 5s", client.Timeout())
+	}
+	if w.Config().Mode != AuthModePermissive {
+		t.Errorf("Config().Mode = %v, want permissive", w.Config().Mode)
+	}
+
+	if err := tw.Emit(trace.AuthzEvent{EventType: trace.EventTypeAuthzCheck}); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(secondTrace); !strings.Contains(string(data), trace.EventTypeAuthzCheck) {
+		t.Errorf("trace event not written to the new destination, got %q", data)
+	}
+
+	// An invalid file keeps the previous configuration
+	replaceFile(t, path, "mode: lenient\n")
+	if err := w.Reload(); err == nil {
+		t.Error("Reload() should reject an invalid file")
+	}
+	if client.Mode() != AuthModePermissive || w.Config().Mode != AuthModePermissive {
+		t.Errorf("mode changed by an invalid file: client %v, watcher %v", client.Mode(), w.Config().Mode)
+	}
+
+	unsubscribe()
+	replaceFile(t, path, "mode: off\n")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("got %d changes after unsubscribing, want 1", len(changes))
+	}
+	if client.Mode() != AuthModeOff {
+		t.Errorf("client.Mode() = %v, want off", client.Mode())
+	}
+}
+
+func TestConfigWatcher_ModeChangeCallback(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	_, addr := startFakeIAMServer(t)
+	path := writeConfigFile(t, "iam.yaml", "mode: strict\nhost: "+addr+"\n")
+
+	// Mode change callbacks may read the watcher and even reload it
+	var w *ConfigWatcher
+	var seen AuthMode
+	client := newTestClient(t, addr, AuthModeStrict, WithModeChangeFunc(func(from, to AuthMode) {
+		seen = w.Config().Mode
+		if err := w.Reload(); err != nil {
+			t.Errorf("nested Reload() error = %v", err)
+		}
+	}))
+
+	w, err := NewConfigWatcher(path, WithWatchClient(client))
+	if err != nil {
+		t.Fatalf("NewConfigWatcher() error = %v", err)
+	}
+
+	replaceFile(t, path, "mode: permissive\nhost: "+addr+"\n")
+	done := make(chan error, 1)
+	go func() { done <- w.Reload() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Reload() deadlocked calling the mode change callback")
+	}
+	if seen != AuthModePermissive || client.Mode() != AuthModePermissive {
+		t.Errorf("callback saw %v, client mode %v, want permissive", seen, client.Mode())
+	}
+}
+
+func TestConfigWatcher_RunPolls(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	path := writeConfigFile(t, "iam.env", "IAM_MODE=strict\n")
+
+	var mu sync.Mutex
+	var errs []error
+	w, err := NewConfigWatcher(path,
+		WithPollInterval(10*time.Millisecond),
+		WithReloadSignals(),
+		WithReloadErrorFunc(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewConfigWatcher() error = %v", err)
+	}
+	if w.Config().Mode != AuthModeStrict {
+		t.Fatalf("Config().Mode = %v, want strict", w.Config().Mode)
+	}
+
+	changed := make(chan Config, 1)
+	w.Subscribe(func(old, new Config) {
+		changed <- new
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	replaceFile(t, path, "IAM_MODE=lenient\n")
+	time.Sleep(50 * time.Millisecond)
+	replaceFile(t, path, "export IAM_MODE=\"audit\"\n")
+
+	select {
+	case cfg := <-changed:
+		if cfg.Mode != AuthModeAudit {
+			t.Errorf("Mode = %v, want audit", cfg.Mode)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("file change not picked up")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "lenient") {
+		t.Errorf("reload errors = %v, want one for the invalid mode", errs)
+	}
+}